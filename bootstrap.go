@@ -3,8 +3,10 @@
 package monica
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"sync"
+	"time"
 
 	"git.apache.org/thrift.git/lib/go/thrift"
 	"github.com/DrWrong/monica/config"
@@ -14,81 +16,157 @@ import (
 )
 
 var (
-	bootStrapLogger     *logger.MonicaLogger
-	beforeQuiteHandlers []func()
-	beforeQuiteWait     []func()
-	WebServer           *webserver.WebServer
+	bootStrapLogger *logger.MonicaLogger
+	WebServer       *webserver.WebServer
+
+	// 已经注册的退出前的处理函数的个数
+	quitHooksLock    sync.Mutex
+	quitHandlerCount int
+	quitWaitCount    int
+)
+
+// 框架注册的组件, 停止的顺序为
+// beforeQuitHandler -> beforeQuitWait -> webserver/thriftserver/worker -> thriftpool -> mysql/redis -> log
+const (
+	logComponent          = "log"
+	mysqlComponent        = "mysql"
+	redisComponent        = "redis"
+	thriftPoolComponent   = "thriftpool:"
+	webServerComponent    = "webserver"
+	thriftServerComponent = "thriftserver"
+	workerComponent       = "worker:"
+	quitHandlerComponent  = "beforeQuitHandler#"
+	quitWaitComponent     = "beforeQuitWait#"
 )
 
+// 服务依赖的组件
+var serverDependencies = []string{logComponent, mysqlComponent, redisComponent, thriftPoolComponent + "*"}
+
 func init() {
 	bootStrapLogger = logger.GetLogger("/monica/bootstrap")
+	// 全局配置的重新加载(包括文件变化)都通过 Reload 进行
+	config.SetGlobalReload(Reload)
 }
 
 // 注册退出前的处理函数
-// 后注册的先处理
+// 后注册的先处理, 所有的处理函数都在 RegisterBeforeQuitWait 注册的函数之前执行
+// 每个处理函数都是一个组件, 超过 DefaultStopTimeout 没有返回时会被跳过
 func RegisterBeforeQuiteHandler(handlers ...func()) {
-	beforeQuiteHandlers = append(handlers, beforeQuiteHandlers...)
+	quitHooksLock.Lock()
+	defer quitHooksLock.Unlock()
+	for i := len(handlers) - 1; i >= 0; i-- {
+		dependsOn := []string{quitWaitComponent + "*"}
+		if quitHandlerCount > 0 {
+			dependsOn = append(dependsOn, fmt.Sprintf("%s%d", quitHandlerComponent, quitHandlerCount-1))
+		}
+		RegisterComponent(quitHookComponent(quitHandlerComponent, quitHandlerCount, handlers[i], 0), dependsOn...)
+		quitHandlerCount++
+	}
 }
 
+// 注册退出前需要等待的函数, 如等待正在处理的请求结束
+// 后注册的先处理, 在webserver, thrift server与后台任务停止之前执行
 func RegisterBeforeQuitWait(waits ...func()) {
-	beforeQuiteWait = append(waits, beforeQuiteWait...)
+	registerBeforeQuitWait(0, waits...)
 }
 
-// 注册thrfit线程池
-func RegisterThriftPool(poolname string, clientFactory interface{}) {
-	field := fmt.Sprintf("thriftpool::%s", poolname)
-
-	hosts, _ := config.Strings(
-		fmt.Sprintf("%s::hosts", field))
-	if len(hosts) == 0 {
-		panic(fmt.Sprintf("%s hosts cannot be empty", poolname))
+// 与 RegisterBeforeQuitWait 相同, timeout 为每个函数的超时时间, 为0时使用 DefaultStopTimeout
+func registerBeforeQuitWait(timeout time.Duration, waits ...func()) {
+	quitHooksLock.Lock()
+	defer quitHooksLock.Unlock()
+	for i := len(waits) - 1; i >= 0; i-- {
+		dependsOn := []string{webServerComponent, thriftServerComponent, workerComponent + "*"}
+		if quitWaitCount > 0 {
+			dependsOn = append(dependsOn, fmt.Sprintf("%s%d", quitWaitComponent, quitWaitCount-1))
+		}
+		RegisterComponent(quitHookComponent(quitWaitComponent, quitWaitCount, waits[i], timeout), dependsOn...)
+		quitWaitCount++
 	}
+}
 
-	framed, _ := config.Bool(
-		fmt.Sprintf("%s::framed", field))
+func quitHookComponent(prefix string, index int, hook func(), timeout time.Duration) Component {
+	return &FuncComponent{
+		ComponentName: fmt.Sprintf("%s%d", prefix, index),
+		StopFunc: func(ctx context.Context) error {
+			hook()
+			return nil
+		},
+		Timeout: timeout,
+	}
+}
 
-	maxIdle, _ := config.Int(
-		fmt.Sprintf("%s::max_idle", field))
+// thrift线程池的配置 对应配置文件中的 `thriftpool::<poolname>`
+type ThriftPoolConfig struct {
+	Hosts     []string `config:"hosts,required"`
+	Framed    bool     `config:"framed"`
+	MaxIdle   int      `config:"max_idle"`
+	MaxRetry  uint     `config:"max_retry"`
+	MaxActive int      `config:"max_active"`
+	Wait      bool     `config:"wait"`
+	// 重试的退避时间 第n次重试等待 RetryBackoff * 2^n 最长不超过 MaxRetryBackoff
+	RetryBackoff    time.Duration `config:"retry_backoff" default:"1s"`
+	MaxRetryBackoff time.Duration `config:"max_retry_backoff" default:"32s"`
+}
 
-	maxRetry, _ := config.Int(
-		fmt.Sprintf("%s::max_retry", field))
+// dm303的配置 对应配置文件中的 `dm303` 部分
+type Dm303Config struct {
+	ServiceName string `config:"service_name,required"`
+	Port        int    `config:"port,required"`
+}
 
-	maxActive, _ := config.Int(fmt.Sprintf("%s::max_active", field))
-	wait, _ := config.Bool(fmt.Sprintf("%s::wait", field))
+// 注册thrfit线程池
+func RegisterThriftPool(poolname string, clientFactory interface{}) {
+	field := fmt.Sprintf("thriftpool::%s", poolname)
 
-	thriftext.GlobalThriftPool[poolname] = &thriftext.Pool{
-		ClientFactory: clientFactory,
-		Framed:        framed,
-		Host:          hosts,
-		MaxIdle:       maxIdle,
-		MaxRetry:      uint(maxRetry),
-		MaxActive:     maxActive,
-		Wait:          wait,
+	poolConfig := &ThriftPoolConfig{}
+	if err := config.Unmarshal(field, poolConfig); err != nil {
+		panic(err)
+	}
+	if len(poolConfig.Hosts) == 0 {
+		panic(fmt.Sprintf("%s hosts cannot be empty", poolname))
 	}
 
+	pool := &thriftext.Pool{
+		ClientFactory:   clientFactory,
+		Framed:          poolConfig.Framed,
+		Host:            poolConfig.Hosts,
+		MaxIdle:         poolConfig.MaxIdle,
+		MaxRetry:        poolConfig.MaxRetry,
+		MaxActive:       poolConfig.MaxActive,
+		Wait:            poolConfig.Wait,
+		RetryBackoff:    poolConfig.RetryBackoff,
+		MaxRetryBackoff: poolConfig.MaxRetryBackoff,
+	}
+	thriftext.GlobalThriftPool[poolname] = pool
+	RegisterComponent(&FuncComponent{
+		ComponentName: thriftPoolComponent + poolname,
+		StopFunc: func(ctx context.Context) error {
+			pool.Close()
+			return nil
+		},
+	}, logComponent)
+
+	// 配置变更时更新线程池的主机列表与大小
+	config.OnChange(field, func(old, new interface{}) {
+		poolConfig := &ThriftPoolConfig{}
+		if err := config.Unmarshal(field, poolConfig); err != nil {
+			bootStrapLogger.Warnf("%s config error, ignore the change: %s", poolname, err)
+			return
+		}
+		if len(poolConfig.Hosts) == 0 {
+			bootStrapLogger.Warnf("%s hosts is empty, ignore the change", poolname)
+			return
+		}
+		pool.Update(poolConfig.Hosts, poolConfig.MaxIdle, poolConfig.MaxActive)
+		bootStrapLogger.Infof("thrift pool %s updated", poolname)
+	})
 }
 
-// 起动一个webserver
+// 起动一个webserver, 与 Run(NewWebServer(postInitFunc)) 相同, 出错时panic
 func BootStrapWeb(postInitFunc func()) {
-	serverConfig, err := config.Map("server")
-	if err != nil {
+	if err := Run(NewWebServer(postInitFunc)); err != nil {
 		panic(err)
 	}
-
-	webServerConfig := &webserver.ServerConfig{
-		Port:       serverConfig["serverport"].(int),
-		ServerMode: serverConfig["servermode"].(string),
-	}
-
-	if prefix, ok := serverConfig["urlPrefix"]; ok {
-		webServerConfig.URLPrefix = prefix.(string)
-	}
-
-	WebServer = webserver.New(webServerConfig)
-
-	postInitFunc()
-
-	WebServer.Run()
 }
 
 // BooststrapThrift 起动thrift server
@@ -101,18 +179,9 @@ func BootstrapThrift(processor thrift.TProcessor) {
 
 }
 
+// 与 Run(NewThriftServer(processor, port)) 相同, 出错时panic
 func BootstrapThriftWithPort(processor thrift.TProcessor, port int) {
-	transportFactory := thrift.NewTFramedTransportFactory(thrift.NewTTransportFactory())
-	protocolFactory := thrift.NewTBinaryProtocolFactoryDefault()
-	networkAddr := fmt.Sprintf(":%d", port)
-	serverTransport, err := thrift.NewTServerSocket(networkAddr)
-	if err != nil {
-		panic(err)
-	}
-	thriftServer := thrift.NewTSimpleServer4(processor, serverTransport, transportFactory, protocolFactory)
-	log.Println("INFO: thrift server in", networkAddr)
-	if err := thriftServer.Serve(); err != nil {
+	if err := Run(NewThriftServer(processor, port)); err != nil {
 		panic(err)
 	}
-
 }
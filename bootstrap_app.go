@@ -1,14 +1,13 @@
 package monica
 
 import (
+	"context"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"log"
 	"os"
 	"os/signal"
 	"path"
-	"strconv"
+	"runtime"
 	"strings"
 	"syscall"
 	"time"
@@ -22,22 +21,24 @@ const MONICA_PROCESS_CHILDREN_FLAG = "MONICA_PROCESS_CHILDREN_FLAG"
 
 var App = NewMonicaApp()
 
-func getConfigerFile() (configPath string) {
-	// // check wheather filename from command line is empty
-	// if configPath = c.String("config"); configPath != "" {
-	//	return configPath
-	// }
+func getConfigerFile(c *cli.Context) (configPath string) {
+	// get config from command line `--config` or env MONICA_CONFIGER
+	// 相对路径相对于运行目录, 后台运行时工作目录可能不同
+	if configPath = c.String("config"); configPath != "" {
+		if !path.IsAbs(configPath) {
+			configPath = path.Join(runDir(), configPath)
+		}
+		return configPath
+	}
 
-	dirName, _ := os.Getwd()
+	dirName := runDir()
 	// get config from current currentdir/config.yaml
-	configPath = path.Join(dirName, "config.yaml")
-	if _, err := os.Stat(configPath); err == nil {
+	if configPath = findConfigFile(path.Join(dirName, "config")); configPath != "" {
 		return configPath
 	}
 
 	// get config path from currentdir/conf/monica.yaml
-	configPath = path.Join(dirName, "conf", "monica.yaml")
-	if _, err := os.Stat(configPath); err == nil {
+	if configPath = findConfigFile(path.Join(dirName, "conf", "monica")); configPath != "" {
 		return configPath
 	}
 
@@ -47,65 +48,120 @@ func getConfigerFile() (configPath string) {
 		return ""
 	}
 
-	configPath = path.Join(goPath, "conf", "monica.yaml")
-	if _, err := os.Stat(configPath); err == nil {
-		return configPath
-	}
+	return findConfigFile(path.Join(goPath, "conf", "monica"))
+}
+
+// config file extensions in the order of priority
+var configFileExts = []string{".yaml", ".yml", ".json", ".ini"}
 
+// find the first exist config file named `name` with one of configFileExts
+func findConfigFile(name string) string {
+	for _, ext := range configFileExts {
+		if _, err := os.Stat(name + ext); err == nil {
+			return name + ext
+		}
+	}
 	return ""
 }
 
+// log的配置 对应配置文件中的 `log` 部分
+type LogConfig struct {
+	Handlers []*logger.HandlerOption `config:"handlers"`
+	Loggers  []*LoggerConfig         `config:"loggers"`
+}
+
+type LoggerConfig struct {
+	Name      string   `config:"name,required"`
+	Handlers  []string `config:"handlers"`
+	Level     string   `config:"level" default:"debug"`
+	Propagate bool     `config:"propagte"`
+}
+
 // log的初始化
 func initLogger() error {
 	defer func() {
 		logger.PostInit()
 	}()
-	handlersConfig, err := config.Maps("log::handlers")
+	RegisterComponent(&FuncComponent{
+		ComponentName: logComponent,
+		StopFunc: func(ctx context.Context) error {
+			return logger.CloseHandlers()
+		},
+	})
+	return loadLogger()
+}
+
+// 根据全局配置创建handler与logger
+// 配置有误时返回错误并保留原有的handler与logger
+func loadLogger() error {
+	prepared, err := prepareLogger(config.GlobalConfiger)
 	if err != nil {
 		return err
 	}
-	handlerOptions := make([]*logger.HandlerOption, 0, len(handlersConfig))
-	for _, config := range handlersConfig {
-		args := config["args"].(map[string]interface{})
-		handlerOptions = append(handlerOptions, &logger.HandlerOption{
-			Name: config["name"].(string),
-			Type: config["type"].(string),
-			Args: args,
-		})
-	}
+	prepared.Install()
+	return nil
+}
 
-	loggerConfig, err := config.Maps("log::loggers")
-	if err != nil {
-		return err
+// 根据configer中的 `log` 创建handler与logger, 调用 Install 之后才会生效
+// 重新加载配置时在新的配置生效之前调用
+func prepareLogger(configer config.Configer) (*logger.PreparedLogger, error) {
+	if _, err := configer.Value("log"); err != nil {
+		return nil, err
 	}
-	loggerOptions := make([]*logger.LoggerOption, 0, len(loggerConfig))
-	for _, config := range loggerConfig {
-		level, _ := logger.ParseLevel(config["level"].(string))
-		handlers := config["handlers"].([]interface{})
-		handlerNames := make([]string, 0, len(handlers))
-		for _, handler := range handlers {
-			handlerNames = append(handlerNames, handler.(string))
-		}
-		handlerNames = append(handlerNames)
+	logConfig := &LogConfig{}
+	if err := config.UnmarshalConfiger(configer, "log", logConfig); err != nil {
+		return nil, err
+	}
+
+	loggerOptions := make([]*logger.LoggerOption, 0, len(logConfig.Loggers))
+	for _, loggerConfig := range logConfig.Loggers {
+		level, _ := logger.ParseLevel(loggerConfig.Level)
 		loggerOptions = append(loggerOptions, &logger.LoggerOption{
-			Name:      config["name"].(string),
-			Handlers:  handlerNames,
+			Name:      loggerConfig.Name,
+			Handlers:  loggerConfig.Handlers,
 			Level:     level,
-			Propagate: config["propagte"].(bool),
+			Propagate: loggerConfig.Propagate,
 		})
 	}
-	logger.InitLogger(handlerOptions, loggerOptions)
-	return nil
+	return logger.PrepareLogger(logConfig.Handlers, loggerOptions)
+}
 
+// parse the repeated `--set key=value` flags
+func parseOverrides(values []string) (map[string]string, error) {
+	overrides := make(map[string]string, len(values))
+	for _, value := range values {
+		index := strings.Index(value, "=")
+		if index <= 0 {
+			return nil, fmt.Errorf("invalid --set %q, should be key=value", value)
+		}
+		overrides[strings.TrimSpace(value[:index])] = value[index+1:]
+	}
+	return overrides, nil
 }
 
-func initGlobalConfig() bool {
-	configPath := getConfigerFile()
+// 读取配置文件 并根据配置初始化log, db 与 redis
+// 没有找到配置文件时返回false
+func initGlobalConfig(c *cli.Context) (bool, error) {
+	overrides, err := parseOverrides(c.StringSlice("set"))
+	if err != nil {
+		return false, err
+	}
+	configPath := getConfigerFile(c)
 	if configPath == "" {
+		if len(overrides) > 0 {
+			return false, fmt.Errorf("--set need a config file")
+		}
 		log.Println("WARNING: config path is empty so we will not load any config")
-		return false
+		return false, nil
 	}
-	config.InitYamlGlobalConfiger(configPath)
+	if err := config.InitGlobalConfigerWithOverrides(configPath, overrides); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// 根据配置初始化log, db 与 redis
+func initFromConfig() {
 	// now config log module
 	if err := initLogger(); err != nil {
 		// fmt.Fprintf(os.Stderr, "init from config error: load default configurre: %s", err)
@@ -115,211 +171,281 @@ func initGlobalConfig() bool {
 	InitDb()
 	// init redis from config
 	InitRedis()
-	return true
 }
 
 type MonicaApp struct {
 	*cli.App
 	daemon             bool
+	supervise          bool
 	globalConfigInited bool
 	name               string
+	// 收到后停止所有组件并退出
+	quit chan os.Signal
+	// 后台运行时持有锁的pid文件
+	pidFile *os.File
 }
 
 func NewMonicaApp() *MonicaApp {
 	app := &MonicaApp{
-		globalConfigInited: initGlobalConfig(),
-		name:               path.Base(os.Args[0]),
+		name: path.Base(os.Args[0]),
+		quit: make(chan os.Signal, 2),
 	}
 	app.App = &cli.App{
 		Name:  "Monica App",
 		Usage: "Bootstrap an app quickly",
 		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "config",
+				Aliases: []string{"c"},
+				Usage:   "the config file, default search config.yaml, conf/monica.yaml and $GOPATH/conf/monica.yaml",
+				EnvVars: []string{"MONICA_CONFIGER"},
+			},
+			&cli.StringSliceFlag{
+				Name:  "set",
+				Usage: "override a config value, e.g. --set server::serverport=8080, can be repeated",
+			},
 			&cli.BoolFlag{
 				Name:        "daemon",
 				Aliases:     []string{"d"},
 				Usage:       "Specific that if you want to run process in daemon",
 				Destination: &app.daemon,
 			},
+			&cli.BoolFlag{
+				Name:        "supervise",
+				Usage:       "run a master process which restarts the worker process when it crashes",
+				Destination: &app.supervise,
+			},
 			&cli.StringFlag{
 				Name:    "signal",
 				Aliases: []string{"s"},
-				Usage:   "send signal to process, accept args status, stop",
+				Usage:   "send signal to process, accept args status, stop, reload, restart, same as the commands",
+			},
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Value: DefaultShutdownTimeout,
+				Usage: "used with -s stop and -s restart, kill the process if it is still running after the timeout",
 			},
 		},
-		Before: app.cliContextRedayHook,
+		Commands: append(app.newProcessCommands(), newConfigCommand()),
+		Before:   app.cliContextRedayHook,
 	}
 	return app
 }
 
 // 当初始化结束后执行的hook
+// 命令行参数解析之后才读取配置 并初始化log, db 与 redis
 func (app *MonicaApp) cliContextRedayHook(c *cli.Context) error {
-	// 检查是否是子进程，如果不是将会开一个子进程并退出主进程
-	if app.daemon {
-		app.runInDaemonMode()
+	// config 子命令自己读取配置文件
+	command := c.App.Command(c.Args().First())
+	if command != nil && command.Name == "config" {
+		return nil
+	}
+	inited, err := initGlobalConfig(c)
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	app.globalConfigInited = inited
+	// 进程管理的子命令只需要读取配置, start 子命令在解析自己的参数之后启动
+	if command != nil && processCommands[command.Name] {
+		return nil
 	}
 
 	// check if signal specified
-	signal := c.String("signal")
-	if signal != "" {
-		app.processSignal(signal)
-		os.Exit(0)
+	if signal := c.String("signal"); signal != "" {
+		os.Exit(app.processSignal(signal, c.Duration("timeout")))
 	}
-	// 能到此的进程是真正做事情的进程
-	if app.daemon {
-		app.writePidFile()
-	}
-	go app.handleSigIntAndTerm()
-	return nil
+	return app.start()
 }
 
-func (app *MonicaApp) getPidFile() string {
-	if app.globalConfigInited {
-		pidFile, _ := config.String("pidfile")
-		if pidFile != "" {
-			// 绝对路径
-			if strings.HasPrefix(pidFile, "/") {
-				return pidFile
-			}
-			return path.Join(os.Getenv("MONICA_RUNDIR"), pidFile)
+// 启动服务: 后台运行, 初始化log, db 与 redis 并启动组件, 写pid文件以及处理信号
+func (app *MonicaApp) start() error {
+	// supervise 模式下master只读取配置, 不初始化log, db 与 redis
+	if app.supervise && !isSupervisedWorker() {
+		if app.daemon {
+			app.runInDaemonMode()
+			app.writePidFile()
 		}
+		app.runAsMaster()
 	}
-	runDir := os.Getenv("MONICA_RUNDIR")
-	if runDir == "" {
-		runDir, _ = os.Getwd()
+	// 检查是否是子进程，如果不是将会开一个子进程并退出主进程
+	// 先进入后台再初始化, log文件, 数据库连接等都属于真正做事情的进程
+	if app.daemon {
+		app.runInDaemonMode()
 	}
-	return path.Join(runDir, "logs", fmt.Sprintf("%s.pid", app.name))
-}
 
-func (app *MonicaApp) getProcess() *os.Process {
-	pidFile := app.getPidFile()
-	rawPid, err := ioutil.ReadFile(pidFile)
-	if err != nil {
-		return nil
+	if app.globalConfigInited {
+		initFromConfig()
 	}
-
-	pid, err := strconv.Atoi(string(rawPid))
-	if err != nil {
-		return nil
+	if err := StartComponents(context.Background()); err != nil {
+		return cli.Exit(err, 1)
 	}
 
-	p, err := os.FindProcess(pid)
-	if err != nil {
-		return nil
+	// 能到此的进程是真正做事情的进程, supervise 模式下pid文件属于master
+	if app.daemon && !isSupervisedWorker() {
+		app.writePidFile()
 	}
-	return p
+	go app.handleSigIntAndTerm()
+	go app.handleSigHup()
+	go app.handleSigUsr2()
+	return nil
 }
 
-func (app *MonicaApp) processAlive(p *os.Process) bool {
-	if p == nil {
-		p = app.getProcess()
-	}
+// 默认的重启超时时间, 可以通过配置中的 `restart_timeout` 修改
+const DefaultRestartTimeout = 30 * time.Second
 
-	if p == nil {
-		return false
+func (app *MonicaApp) restartTimeout() time.Duration {
+	if !app.globalConfigInited {
+		return DefaultRestartTimeout
 	}
-	if err := p.Signal(syscall.Signal(0)); err != nil {
-		return false
-	} else {
-		return true
+	timeout, err := config.Duration("restart_timeout")
+	if err != nil || timeout <= 0 {
+		return DefaultRestartTimeout
 	}
-
+	return timeout
 }
 
-func (app *MonicaApp) processSignal(signal string) {
-	p := app.getProcess()
-	if p == nil {
-		log.Println("INFO: process is gone")
-		return
-	}
-	// check status
-	alive := app.processAlive(p)
-	if !alive {
-		log.Println("INFO: process is gone")
-	} else if signal == "status" {
-		log.Println("INFO: process is running at", p.Pid)
+// 启动一个新的进程并把所有的监听传递给它, 新的进程准备好之后返回
+// 新的进程在 restart_timeout 内没有准备好时将其杀掉并返回错误, 当前进程继续运行
+func (app *MonicaApp) restart() error {
+	files, keys, err := listenerFiles()
+	if err != nil {
+		return err
 	}
-
-	if alive && signal == "stop" {
-		if err := p.Signal(syscall.SIGTERM); err != nil {
-			log.Println("INFO: process is gone")
-			return
-		}
-
-		for {
-			time.Sleep(time.Second)
-			if err := p.Signal(syscall.Signal(0)); err != nil {
-				log.Println("INFO: process is gone")
-				break
-			}
-
-			log.Println("INFO: process is still running wait it exit", p.Pid)
+	defer func() {
+		for _, f := range files {
+			f.Close()
 		}
+	}()
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return err
 	}
-}
+	defer reader.Close()
+	env := []string{
+		fmt.Sprintf("%s=%s", MONICA_LISTENERS, keys),
+		fmt.Sprintf("%s=%d", MONICA_READY_FD, extraFilesStart+len(files)),
+	}
+	extraFiles := append(files, writer)
+	// pid文件的锁由新的进程继续持有
+	if app.pidFile != nil {
+		env = append(env, fmt.Sprintf("%s=%d", MONICA_PIDFILE_FD, extraFilesStart+len(extraFiles)))
+		extraFiles = append(extraFiles, app.pidFile)
+	}
+	p, err := app.startChild(append([]*os.File{os.Stdin, os.Stdout, os.Stderr}, extraFiles...), "", env, nil)
+	writer.Close()
+	if err != nil {
+		return fmt.Errorf("start new process error: %s", err)
+	}
+	log.Println("INFO: new process started at", p.Pid, "wait it ready")
 
-func (app *MonicaApp) writePidFile() {
-	pidFile := app.getPidFile()
-	f, err := os.OpenFile(pidFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	// 子进程准备好之后写入管道, 子进程退出时读到EOF
+	ready := make(chan error, 1)
+	go func() {
+		_, err := reader.Read(make([]byte, 8))
+		ready <- err
+	}()
+	timeout := app.restartTimeout()
+	select {
+	case err = <-ready:
+	case <-time.After(timeout):
+		err = fmt.Errorf("not ready after %s", timeout)
+	}
 	if err != nil {
-		panic(err)
+		p.Kill()
+		p.Wait()
+		return fmt.Errorf("new process %d error: %s", p.Pid, err)
 	}
-	defer f.Close()
-	io.WriteString(f, fmt.Sprintf("%d", os.Getpid()))
+	p.Release()
+	handOverListeners()
+	return nil
 }
 
-func (app *MonicaApp) runInDaemonMode() {
-	// is children then we do nothing
-	if os.Getenv(MONICA_PROCESS_CHILDREN_FLAG) != "" {
+// 收到 SIGUSR2 后重启: 新的进程准备好之后停止当前进程
+func (app *MonicaApp) handleSigUsr2() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR2)
+	for sig := range c {
+		log.Println("INFO: SIGUSR2 received, restart")
+		if err := app.restart(); err != nil {
+			log.Println("WARNING: restart error, keep running", err)
+			bootStrapLogger.Warnf("restart error, keep running: %s", err)
+			continue
+		}
+		log.Println("INFO: new process is ready, stop the old one")
+		app.quit <- sig
 		return
 	}
+}
 
-	// first we should check if any file already running
-	if app.processAlive(nil) {
-		log.Fatalln("process is alive we will not start again...")
-	}
+// 默认的退出超时时间, 可以通过配置中的 `shutdown_timeout` 修改
+const DefaultShutdownTimeout = 30 * time.Second
 
-	// spawn children process
-	log.Println("INFO: starting process as daemon")
-	_, err := os.StartProcess(
-		os.Args[0],
-		os.Args,
-		&os.ProcAttr{
-			Env: append(os.Environ(), fmt.Sprintf("%s=true", MONICA_PROCESS_CHILDREN_FLAG)),
-			Files: []*os.File{
-				nil,
-				os.Stdout,
-				os.Stderr,
-			},
-		},
-	)
-	if err != nil {
-		log.Println("FATAL: create new process error")
-		os.Exit(1)
+func (app *MonicaApp) shutdownTimeout() time.Duration {
+	if !app.globalConfigInited {
+		return DefaultShutdownTimeout
 	}
-	time.Sleep(time.Second)
-	if app.processAlive(nil) {
-		log.Println("INFO: process is started")
+	timeout, err := config.Duration("shutdown_timeout")
+	if err != nil || timeout <= 0 {
+		return DefaultShutdownTimeout
 	}
-	os.Exit(0)
+	return timeout
 }
 
+// 收到 SIGINT/SIGTERM 后停止所有的组件并退出
+// 超过 shutdown_timeout 还没有停止时将所有goroutine的堆栈写入日志并以1退出
+// 停止过程中再次收到信号时立即退出
 func (app *MonicaApp) handleSigIntAndTerm() {
-	c := make(chan os.Signal)
+	c := app.quit
 	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
-	//sig is blocked as c is 没缓冲
 	sig := <-c
+	timeout := app.shutdownTimeout()
 	log.Println("INFO: signal received", sig)
-	log.Println("INFO: server is going to do some hourse keeping work")
-	for _, handler := range beforeQuiteHandlers {
-		handler()
+	log.Println("INFO: server is going to stop all the components in", timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- StopComponents(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		if ctx.Err() == nil {
+			if err != nil {
+				log.Println("WARNING:", err)
+			}
+			log.Println("INFO: byebye")
+			app.exit(0)
+		}
+	case <-ctx.Done():
+	case sig := <-c:
+		log.Println("WARNING: signal received again, force exit", sig)
+		app.exit(1)
 	}
-	log.Println("INFO: server is going to wait")
-	for _, handler := range beforeQuiteWait {
-		handler()
+
+	dump := goroutineDump()
+	log.Printf("ERROR: shutdown timeout after %s, goroutines:\n%s", timeout, dump)
+	bootStrapLogger.Errorf("shutdown timeout after %s, goroutines:\n%s", timeout, dump)
+	app.exit(1)
+}
+
+func (app *MonicaApp) exit(code int) {
+	// 重启时pid文件已经属于新的进程
+	if p := app.getProcess(); app.daemon && p != nil && p.Pid == os.Getpid() {
+		app.removePidFile()
 	}
-	log.Println("INFO: byebye")
-	if app.daemon {
-		os.Remove(app.getPidFile())
+	os.Exit(code)
+}
+
+// 所有goroutine的堆栈
+func goroutineDump() []byte {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, len(buf)*2)
 	}
-	os.Exit(0)
 }
@@ -1,10 +1,13 @@
 package config
 
-var (
-	GlobalConfiger     Configer
+import (
+	"sync"
+	"time"
 )
 
-
+var (
+	GlobalConfiger Configer
+)
 
 // 每一个配置需实现如下接口
 // key的形式 a::b::c  用::表示Map的层级,
@@ -18,51 +21,158 @@ type Configer interface {
 	Floats(key string) ([]float64, error)
 	Bool(key string) (bool, error)
 	Bools(key string) ([]bool, error)
+	// 时间间隔, 如 `240s` `5m`
+	Duration(key string) (time.Duration, error)
+	// 字节大小, 如 `64MB`
+	Size(key string) (ByteSize, error)
 	Map(key string) (map[string]interface{}, error)
 	Maps(key string) ([]map[string]interface{}, error)
+	// 获取key对应的原始值
+	Value(key string) (interface{}, error)
+	// key是否存在
+	Has(key string) bool
+	// key对应的map的所有key, 按字母序排列, key为空时返回顶层的key
+	Keys(key string) ([]string, error)
+	// key对应的子配置, 子配置中的key相对于该key, 如 Sub("mysql").String("default::dsn")
+	Sub(key string) Configer
 }
 
 func String(key string) (string, error) {
 	return GlobalConfiger.String(key)
 }
 
-func Strings(key string)([]string, error) {
+func Strings(key string) ([]string, error) {
 	return GlobalConfiger.Strings(key)
 }
 
-func Int(key string)(int, error) {
+func Int(key string) (int, error) {
 	return GlobalConfiger.Int(key)
 }
 
-func Ints(key string)([]int, error) {
+func Ints(key string) ([]int, error) {
 	return GlobalConfiger.Ints(key)
 }
 
-func Float(key string)(float64, error) {
+func Float(key string) (float64, error) {
 	return GlobalConfiger.Float(key)
 }
 
-func Floats(key string)([]float64, error) {
+func Floats(key string) ([]float64, error) {
 	return GlobalConfiger.Floats(key)
 }
 
-func Bool(key string)(bool, error) {
+func Bool(key string) (bool, error) {
 	return GlobalConfiger.Bool(key)
 }
 
-func Bools(key string)([]bool, error) {
+func Bools(key string) ([]bool, error) {
 	return GlobalConfiger.Bools(key)
 }
 
-func Map(key string)(map[string]interface{}, error) {
+func Duration(key string) (time.Duration, error) {
+	return GlobalConfiger.Duration(key)
+}
+
+func Size(key string) (ByteSize, error) {
+	return GlobalConfiger.Size(key)
+}
+
+func Map(key string) (map[string]interface{}, error) {
 	return GlobalConfiger.Map(key)
 }
 
-func Maps(key string)([]map[string]interface{}, error) {
+func Maps(key string) ([]map[string]interface{}, error) {
 	return GlobalConfiger.Maps(key)
 }
 
+func Value(key string) (interface{}, error) {
+	return GlobalConfiger.Value(key)
+}
+
+func Has(key string) bool {
+	return GlobalConfiger.Has(key)
+}
+
+func Keys(key string) ([]string, error) {
+	return GlobalConfiger.Keys(key)
+}
+
+func Sub(key string) Configer {
+	return GlobalConfiger.Sub(key)
+}
+
+// 初始化全局配置, 根据文件扩展名选择yaml, json 或者 ini 的实现
+// 环境变量中的配置会覆盖文件中的配置, 配置中的 `${...}` 会被替换, 详见 InterpolateConfig
+// `enc:v1:` 开头的值会被解密, 详见 SecretConfig
+// 会根据runmode读取覆盖的配置文件, 详见 LoadLayeredConfig
+// 配置文件会被监听, 文件修改后自动重新加载
+func InitGlobalConfiger(filename string) error {
+	return InitGlobalConfigerWithOverrides(filename, nil)
+}
+
+// 初始化全局配置, overrides 会覆盖配置文件与环境变量中的值, 详见 NewOverrideConfig
+func InitGlobalConfigerWithOverrides(filename string, overrides map[string]string) error {
+	format, err := getFileFormat(filename)
+	if err != nil {
+		return err
+	}
+	var (
+		filesLock sync.Mutex
+		files     []string
+	)
+	reloadable, err := NewReloadableConfig(func() (Configer, error) {
+		tree, err := loadLayered(filename, "")
+		if err != nil {
+			return nil, err
+		}
+		filesLock.Lock()
+		files = tree.Files()
+		filesLock.Unlock()
+		return wrapFileConfiger(format.wrap(tree), overrides)
+	})
+	if err != nil {
+		return err
+	}
+	reloadable.WatchFiles(DefaultWatchInterval, func() []string {
+		filesLock.Lock()
+		defer filesLock.Unlock()
+		return files
+	})
+	GlobalConfiger = reloadable
+	return nil
+}
+
+// 读取配置文件, 与全局配置相同的叠加runmode覆盖文件, 环境变量, 解密与变量替换
+// 但不会监听文件的变化, 用于检查配置文件
+func LoadConfiger(filename string) (Configer, error) {
+	format, err := getFileFormat(filename)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := loadLayered(filename, "")
+	if err != nil {
+		return nil, err
+	}
+	return wrapFileConfiger(format.wrap(tree), nil)
+}
+
+// 在文件的配置之上依次叠加环境变量覆盖, overrides覆盖, 解密与变量替换
+func wrapFileConfiger(configer Configer, overrides map[string]string) (Configer, error) {
+	key, err := LoadSecretKey()
+	if err != nil && err != ErrNoSecretKey {
+		return nil, err
+	}
+	configer = NewEnvConfig(DefaultEnvPrefix, configer)
+	if len(overrides) > 0 {
+		configer = NewOverrideConfig(overrides, configer)
+	}
+	configer = newLiteralSecretConfig(configer, key)
+	return NewInterpolateConfig(configer), nil
+}
 
+// 初始化yaml的全局配置, 出错时panic
 func InitYamlGlobalConfiger(filename string) {
-	GlobalConfiger = NewYamlConfig(filename)
+	if err := InitGlobalConfiger(filename); err != nil {
+		panic(err)
+	}
 }
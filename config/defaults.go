@@ -0,0 +1,64 @@
+package config
+
+import (
+	"time"
+)
+
+// 以下函数读取全局配置, 读取出错(key不存在或者类型不匹配)时返回默认值
+// 需要区分错误时请使用 String 等函数, 并通过 IsNotFound/IsTypeMismatch 判断
+
+func StringOr(key string, def string) string {
+	if res, err := GlobalConfiger.String(key); err == nil {
+		return res
+	}
+	return def
+}
+
+func StringsOr(key string, def []string) []string {
+	if res, err := GlobalConfiger.Strings(key); err == nil {
+		return res
+	}
+	return def
+}
+
+func IntOr(key string, def int) int {
+	if res, err := GlobalConfiger.Int(key); err == nil {
+		return res
+	}
+	return def
+}
+
+func IntsOr(key string, def []int) []int {
+	if res, err := GlobalConfiger.Ints(key); err == nil {
+		return res
+	}
+	return def
+}
+
+func FloatOr(key string, def float64) float64 {
+	if res, err := GlobalConfiger.Float(key); err == nil {
+		return res
+	}
+	return def
+}
+
+func BoolOr(key string, def bool) bool {
+	if res, err := GlobalConfiger.Bool(key); err == nil {
+		return res
+	}
+	return def
+}
+
+func DurationOr(key string, def time.Duration) time.Duration {
+	if res, err := GlobalConfiger.Duration(key); err == nil {
+		return res
+	}
+	return def
+}
+
+func SizeOr(key string, def ByteSize) ByteSize {
+	if res, err := GlobalConfiger.Size(key); err == nil {
+		return res
+	}
+	return def
+}
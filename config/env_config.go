@@ -0,0 +1,448 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// 默认的环境变量前缀
+const DefaultEnvPrefix = "MONICA"
+
+// 环境变量的配置实现
+// 读取配置时优先读取环境变量, 环境变量不存在时再从fallback中读取
+// key `mysql::default::dsn` 对应的环境变量为 `MONICA_MYSQL__DEFAULT__DSN`
+type EnvConfig struct {
+	prefix   string
+	fallback Configer
+	// 不为nil时从vars中读取, 而不是读取进程的环境变量
+	vars map[string]string
+}
+
+func NewEnvConfig(prefix string, fallback Configer) Configer {
+	return &EnvConfig{
+		prefix:   prefix,
+		fallback: fallback,
+	}
+}
+
+// 覆盖配置中的值, 如命令行中的 `--set server::serverport=80`
+// overrides 的key为 `server::serverport` 的形式, 值的解析规则与环境变量相同
+func NewOverrideConfig(overrides map[string]string, fallback Configer) Configer {
+	config := &EnvConfig{
+		prefix:   DefaultEnvPrefix,
+		fallback: fallback,
+		vars:     make(map[string]string, len(overrides)),
+	}
+	for key, value := range overrides {
+		config.vars[config.envName(key)] = value
+	}
+	return config
+}
+
+// 获取key对应的环境变量名称
+// `::` 替换为 `__`, 其它非字母数字的字符替换为 `_`
+func (config *EnvConfig) envName(key string) string {
+	key = strings.Replace(key, "::", "__", -1)
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, key)
+	if config.prefix == "" {
+		return strings.ToUpper(name)
+	}
+	return strings.ToUpper(config.prefix + "_" + name)
+}
+
+func (config *EnvConfig) lookup(key string) (string, string, bool) {
+	name := config.envName(key)
+	if config.vars != nil {
+		value, ok := config.vars[name]
+		return name, value, ok
+	}
+	value, ok := os.LookupEnv(name)
+	return name, value, ok
+}
+
+// key的值来自于哪个环境变量, 依次检查key本身与它的上级, 如
+// `mysql::default::dsn` 可能来自 `MONICA_MYSQL__DEFAULT__DSN` 或 `MONICA_MYSQL`
+func (config *EnvConfig) source(key string) (string, bool) {
+	for {
+		if name, _, ok := config.lookup(key); ok {
+			return name, true
+		}
+		index := strings.LastIndex(key, "::")
+		if index < 0 {
+			return "", false
+		}
+		key = key[:index]
+	}
+}
+
+func (config *EnvConfig) String(key string) (string, error) {
+	if _, value, ok := config.lookup(key); ok {
+		return value, nil
+	}
+	return config.fallback.String(key)
+}
+
+func (config *EnvConfig) Strings(key string) ([]string, error) {
+	name, value, ok := config.lookup(key)
+	if !ok {
+		return config.fallback.Strings(key)
+	}
+	items, err := splitEnvList(key, name, value)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		result = append(result, fmt.Sprint(item))
+	}
+	return result, nil
+}
+
+func (config *EnvConfig) Int(key string) (int, error) {
+	name, value, ok := config.lookup(key)
+	if !ok {
+		return config.fallback.Int(key)
+	}
+	return parseEnvInt(key, name, value)
+}
+
+func (config *EnvConfig) Ints(key string) ([]int, error) {
+	name, value, ok := config.lookup(key)
+	if !ok {
+		return config.fallback.Ints(key)
+	}
+	items, err := splitEnvList(key, name, value)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]int, 0, len(items))
+	for _, item := range items {
+		i, err := parseEnvInt(key, name, fmt.Sprint(item))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, i)
+	}
+	return result, nil
+}
+
+func (config *EnvConfig) Float(key string) (float64, error) {
+	name, value, ok := config.lookup(key)
+	if !ok {
+		return config.fallback.Float(key)
+	}
+	return parseEnvFloat(key, name, value)
+}
+
+func (config *EnvConfig) Floats(key string) ([]float64, error) {
+	name, value, ok := config.lookup(key)
+	if !ok {
+		return config.fallback.Floats(key)
+	}
+	items, err := splitEnvList(key, name, value)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]float64, 0, len(items))
+	for _, item := range items {
+		f, err := parseEnvFloat(key, name, fmt.Sprint(item))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, f)
+	}
+	return result, nil
+}
+
+func (config *EnvConfig) Bool(key string) (bool, error) {
+	name, value, ok := config.lookup(key)
+	if !ok {
+		return config.fallback.Bool(key)
+	}
+	return parseEnvBool(key, name, value)
+}
+
+func (config *EnvConfig) Bools(key string) ([]bool, error) {
+	name, value, ok := config.lookup(key)
+	if !ok {
+		return config.fallback.Bools(key)
+	}
+	items, err := splitEnvList(key, name, value)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]bool, 0, len(items))
+	for _, item := range items {
+		b, err := parseEnvBool(key, name, fmt.Sprint(item))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, b)
+	}
+	return result, nil
+}
+
+func (config *EnvConfig) Duration(key string) (time.Duration, error) {
+	name, value, ok := config.lookup(key)
+	if !ok {
+		return config.fallback.Duration(key)
+	}
+	d, ok := toDuration(value)
+	if !ok {
+		return 0, typeMismatch(key, "env %s is not a duration: %q", name, value)
+	}
+	return d, nil
+}
+
+func (config *EnvConfig) Size(key string) (ByteSize, error) {
+	name, value, ok := config.lookup(key)
+	if !ok {
+		return config.fallback.Size(key)
+	}
+	size, ok := toSize(value)
+	if !ok {
+		return 0, typeMismatch(key, "env %s is not a size: %q", name, value)
+	}
+	return size, nil
+}
+
+// Map 会将 `MONICA_SERVER__SERVERPORT` 这类以key为前缀的环境变量合并到结果中
+func (config *EnvConfig) Map(key string) (map[string]interface{}, error) {
+	name, value, ok := config.lookup(key)
+	if ok {
+		parsed, err := parseEnvYaml(name, value)
+		if err != nil {
+			return nil, err
+		}
+		res, ok := parsed.(map[string]interface{})
+		if !ok {
+			return nil, typeMismatch(key, "env %s is not a map", name)
+		}
+		return res, nil
+	}
+
+	res, err := config.fallback.Map(key)
+	// 根节点的环境变量为 `MONICA_SERVER` 这样的形式, 不能在name后面再拼接 `__`
+	prefix := name + "__"
+	if key == "" {
+		prefix = strings.ToUpper(config.prefix) + "_"
+		if config.prefix == "" {
+			prefix = ""
+		}
+	}
+	overrides := config.envOverrides(prefix)
+	if err != nil && len(overrides) == 0 {
+		return nil, err
+	}
+	res = copyMap(res)
+	for path, value := range overrides {
+		setEnvOverride(res, path, value)
+	}
+	return res, nil
+}
+
+func (config *EnvConfig) Maps(key string) ([]map[string]interface{}, error) {
+	name, value, ok := config.lookup(key)
+	if !ok {
+		return config.fallback.Maps(key)
+	}
+	parsed, err := parseEnvYaml(name, value)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := parsed.([]interface{})
+	if !ok {
+		return nil, typeMismatch(key, "env %s is not a list", name)
+	}
+	result := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, typeMismatch(key, "env %s is not a list of map", name)
+		}
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+func (config *EnvConfig) Value(key string) (interface{}, error) {
+	name, value, ok := config.lookup(key)
+	res, err := config.fallback.Value(key)
+	if ok {
+		return coerceEnvValue(name, value, res), nil
+	}
+	if _, isMap := res.(map[string]interface{}); isMap || err != nil {
+		return config.Map(key)
+	}
+	return res, nil
+}
+
+// 找出所有以prefix开头的环境变量, 返回去掉前缀后按 `__` 分割的路径
+func (config *EnvConfig) envOverrides(prefix string) map[string]string {
+	vars := config.vars
+	if vars == nil {
+		vars = map[string]string{}
+		for _, env := range os.Environ() {
+			if index := strings.Index(env, "="); index >= 0 {
+				vars[env[:index]] = env[index+1:]
+			}
+		}
+	}
+	overrides := map[string]string{}
+	for name, value := range vars {
+		if !strings.HasPrefix(name, prefix) || len(name) == len(prefix) {
+			continue
+		}
+		overrides[name[len(prefix):]] = value
+	}
+	return overrides
+}
+
+// 将环境变量的值写入map中, key按大小写不敏感的方式匹配已有的key
+// 值按原有值的类型转换, 见 coerceEnvValue
+func setEnvOverride(m map[string]interface{}, path string, value string) {
+	parts := strings.Split(path, "__")
+	for index, part := range parts {
+		key := strings.ToLower(part)
+		for existKey := range m {
+			if strings.EqualFold(existKey, part) {
+				key = existKey
+				break
+			}
+		}
+
+		if index == len(parts)-1 {
+			m[key] = coerceEnvValue("", value, m[key])
+			return
+		}
+
+		child, ok := m[key].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+		} else {
+			child = copyMap(child)
+		}
+		m[key] = child
+		m = child
+	}
+}
+
+func copyMap(in map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(in))
+	for key, value := range in {
+		out[key] = value
+	}
+	return out
+}
+
+// 按照原有值的类型转换环境变量的值
+// 原有值不存在或是字符串时保留原始的字符串, 避免 `off` `no` 这类值被当作bool
+// 转换失败时同样保留原始的字符串, 由读取方报告类型错误
+func coerceEnvValue(name, value string, base interface{}) interface{} {
+	trimmed := strings.TrimSpace(value)
+	switch base.(type) {
+	case int, int64, uint64:
+		if i, err := strconv.Atoi(trimmed); err == nil {
+			return i
+		}
+	case float64:
+		if f, err := strconv.ParseFloat(trimmed, 64); err == nil {
+			return f
+		}
+	case bool:
+		if b, err := strconv.ParseBool(trimmed); err == nil {
+			return b
+		}
+	case []interface{}:
+		if items, err := splitEnvList("", name, value); err == nil {
+			return items
+		}
+	case map[string]interface{}:
+		if parsed, err := parseEnvYaml(name, value); err == nil {
+			if m, ok := parsed.(map[string]interface{}); ok {
+				return m
+			}
+		}
+	}
+	return value
+}
+
+// 以yaml的方式解析环境变量的值, 如 `8205` `true` `[a, b]` `{dsn: xxx}`
+func parseEnvYaml(name, value string) (interface{}, error) {
+	var res interface{}
+	if err := yaml.Unmarshal([]byte(value), &res); err != nil {
+		return nil, fmt.Errorf("parse env %s error: %s", name, err)
+	}
+	return convertYamlValue(res), nil
+}
+
+// 列表形式的环境变量可以写成 `a,b,c` 也可以写成 `[a, b, c]`
+func splitEnvList(key, name, value string) ([]interface{}, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return []interface{}{}, nil
+	}
+	if strings.HasPrefix(value, "[") {
+		parsed, err := parseEnvYaml(name, value)
+		if err != nil {
+			return nil, err
+		}
+		items, ok := parsed.([]interface{})
+		if !ok {
+			return nil, typeMismatch(key, "env %s is not a list", name)
+		}
+		return items, nil
+	}
+	parts := strings.Split(value, ",")
+	items := make([]interface{}, 0, len(parts))
+	for _, part := range parts {
+		items = append(items, strings.TrimSpace(part))
+	}
+	return items, nil
+}
+
+func parseEnvInt(key, name, value string) (int, error) {
+	i, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return 0, typeMismatch(key, "env %s is not an int: %q", name, value)
+	}
+	return i, nil
+}
+
+func parseEnvFloat(key, name, value string) (float64, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, typeMismatch(key, "env %s is not a float: %q", name, value)
+	}
+	return f, nil
+}
+
+func parseEnvBool(key, name, value string) (bool, error) {
+	b, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return false, typeMismatch(key, "env %s is not a bool: %q", name, value)
+	}
+	return b, nil
+}
+
+func (config *EnvConfig) Has(key string) bool {
+	return hasKey(config, key)
+}
+
+func (config *EnvConfig) Keys(key string) ([]string, error) {
+	return mapKeys(config, key)
+}
+
+func (config *EnvConfig) Sub(key string) Configer {
+	return newSubConfig(config, key)
+}
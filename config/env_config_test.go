@@ -0,0 +1,174 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+const testYaml = `
+server:
+    serverport: 8205
+    servermode: http
+    urlPrefix: "/api"
+mysql:
+    default:
+        dsn: "user:pass@tcp(127.0.0.1:3306)/app"
+        maxIdle: 5
+thriftpool:
+    upserver:
+        hosts:
+            - "10.0.0.206:3091"
+`
+
+func newTestYamlConfig(t *testing.T, content string) Configer {
+	f, err := ioutil.TempFile("", "monica_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(content)
+	f.Close()
+	return NewYamlConfig(f.Name())
+}
+
+func TestEnvConfig(t *testing.T) {
+	config := NewEnvConfig(DefaultEnvPrefix, newTestYamlConfig(t, testYaml))
+
+	os.Setenv("MONICA_SERVER__SERVERPORT", "9000")
+	os.Setenv("MONICA_MYSQL__DEFAULT__DSN", "root:root@tcp(db:3306)/app")
+	os.Setenv("MONICA_SERVER__URLPREFIX", "/v2")
+	os.Setenv("MONICA_THRIFTPOOL__UPSERVER__HOSTS", "a:1, b:2")
+	defer func() {
+		os.Unsetenv("MONICA_SERVER__SERVERPORT")
+		os.Unsetenv("MONICA_MYSQL__DEFAULT__DSN")
+		os.Unsetenv("MONICA_SERVER__URLPREFIX")
+		os.Unsetenv("MONICA_THRIFTPOOL__UPSERVER__HOSTS")
+	}()
+
+	if port, err := config.Int("server::serverport"); err != nil || port != 9000 {
+		t.Errorf("server::serverport got %d %v", port, err)
+	}
+	if mode, err := config.String("server::servermode"); err != nil || mode != "http" {
+		t.Errorf("server::servermode got %s %v", mode, err)
+	}
+	hosts, err := config.Strings("thriftpool::upserver::hosts")
+	if err != nil || len(hosts) != 2 || hosts[1] != "b:2" {
+		t.Errorf("thriftpool::upserver::hosts got %v %v", hosts, err)
+	}
+
+	server, err := config.Map("server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server["serverport"] != 9000 || server["urlPrefix"] != "/v2" {
+		t.Errorf("server got %v", server)
+	}
+
+	mysql, err := config.Map("mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dsn := mysql["default"].(map[string]interface{})["dsn"]
+	if dsn != "root:root@tcp(db:3306)/app" {
+		t.Errorf("mysql::default::dsn got %v", dsn)
+	}
+}
+
+func TestOverrideConfig(t *testing.T) {
+	os.Setenv("MONICA_SERVER__SERVERPORT", "9000")
+	defer os.Unsetenv("MONICA_SERVER__SERVERPORT")
+
+	config := NewOverrideConfig(map[string]string{
+		"server::serverport":  "80",
+		"mysql::default::dsn": "root:root@tcp(db:3306)/app",
+	}, NewEnvConfig(DefaultEnvPrefix, newTestYamlConfig(t, testYaml)))
+
+	if port, err := config.Int("server::serverport"); err != nil || port != 80 {
+		t.Errorf("server::serverport got %d %v", port, err)
+	}
+	server, err := config.Map("server")
+	if err != nil || server["serverport"] != 80 || server["servermode"] != "http" {
+		t.Errorf("server got %v %v", server, err)
+	}
+	if dsn, err := config.String("mysql::default::dsn"); err != nil || dsn != "root:root@tcp(db:3306)/app" {
+		t.Errorf("mysql::default::dsn got %s %v", dsn, err)
+	}
+}
+
+func TestEnvConfigKeepString(t *testing.T) {
+	config := &EnvConfig{
+		prefix:   DefaultEnvPrefix,
+		fallback: newTestYamlConfig(t, testYaml),
+		vars: map[string]string{
+			"MONICA_FEATURE__MODE":           "off",
+			"MONICA_SERVER__SERVERMODE":      "no",
+			"MONICA_MYSQL__DEFAULT__MAXIDLE": "10",
+			"MONICA_RUNMODE":                 "dev",
+		},
+	}
+
+	if mode, err := config.Value("feature::mode"); err != nil || mode != "off" {
+		t.Errorf("feature::mode got %#v %v", mode, err)
+	}
+	feature, err := config.Map("feature")
+	if err != nil || feature["mode"] != "off" {
+		t.Errorf("feature got %v %v", feature, err)
+	}
+	server, err := config.Map("server")
+	if err != nil || server["servermode"] != "no" || server["serverport"] != 8205 {
+		t.Errorf("server got %v %v", server, err)
+	}
+	if maxIdle, err := config.Value("mysql::default::maxIdle"); err != nil || maxIdle != 10 {
+		t.Errorf("mysql::default::maxIdle got %#v %v", maxIdle, err)
+	}
+
+	root, err := config.Map("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root["runmode"] != "dev" {
+		t.Errorf("runmode got %#v", root["runmode"])
+	}
+	if mode := root["feature"].(map[string]interface{})["mode"]; mode != "off" {
+		t.Errorf("feature::mode got %#v", mode)
+	}
+}
+
+func TestEnvConfigDurationSize(t *testing.T) {
+	config := &EnvConfig{
+		prefix:   DefaultEnvPrefix,
+		fallback: newTestYamlConfig(t, testYaml),
+		vars: map[string]string{
+			"MONICA_X__TIMEOUT":  "240",
+			"MONICA_X__IDLE":     "5m",
+			"MONICA_X__MAXBYTES": "1024",
+			"MONICA_X__BUFFER":   "64KB",
+		},
+	}
+
+	if d, err := config.Duration("x::timeout"); err != nil || d != 240*time.Second {
+		t.Errorf("x::timeout got %v %v", d, err)
+	}
+	if d, err := config.Duration("x::idle"); err != nil || d != 5*time.Minute {
+		t.Errorf("x::idle got %v %v", d, err)
+	}
+	if size, err := config.Size("x::maxbytes"); err != nil || size != 1024 {
+		t.Errorf("x::maxbytes got %v %v", size, err)
+	}
+	if size, err := config.Size("x::buffer"); err != nil || size != 64*KiloByte {
+		t.Errorf("x::buffer got %v %v", size, err)
+	}
+
+	var x struct {
+		Timeout time.Duration
+		Buffer  ByteSize
+	}
+	if err := UnmarshalConfiger(config, "x", &x); err != nil {
+		t.Fatal(err)
+	}
+	if x.Timeout != 240*time.Second || x.Buffer != 64*KiloByte {
+		t.Errorf("x got %+v", x)
+	}
+}
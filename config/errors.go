@@ -0,0 +1,59 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// key不存在
+	ErrKeyNotFound = errors.New("key not found")
+	// 值不能转换为需要的类型
+	ErrTypeMismatch = errors.New("type mismatch")
+)
+
+// 读取配置时的错误, 包含了出错的完整key
+// Err 为 ErrKeyNotFound 或者 ErrTypeMismatch, 可以通过 errors.Is 判断
+type KeyError struct {
+	Key    string
+	Err    error
+	Reason string
+}
+
+func (e *KeyError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("config %s: %s", e.Key, e.Err)
+	}
+	return fmt.Sprintf("config %s: %s, %s", e.Key, e.Err, e.Reason)
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+func notFound(key string) error {
+	return &KeyError{Key: key, Err: ErrKeyNotFound}
+}
+
+func typeMismatch(key string, format string, args ...interface{}) error {
+	return &KeyError{Key: key, Err: ErrTypeMismatch, Reason: fmt.Sprintf(format, args...)}
+}
+
+// 判断错误是否为key不存在
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrKeyNotFound)
+}
+
+// 判断错误是否为类型不匹配
+func IsTypeMismatch(err error) bool {
+	return errors.Is(err, ErrTypeMismatch)
+}
+
+// 将原始值转换为out的类型, 转换失败时返回 ErrTypeMismatch
+func decodeKey(key string, raw interface{}, out interface{}) error {
+	err := decodeValue(key, raw, out)
+	if errs, ok := err.(UnmarshalErrors); ok {
+		return &KeyError{Key: errs[0].Key, Err: ErrTypeMismatch, Reason: errs[0].Reason}
+	}
+	return err
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJsonAndIniConfig(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"config.json": `{
+    "server": {"serverport": 8205, "servermode": "http", "weight": 0.5},
+    "thriftpool": {"upserver": {"hosts": ["10.0.0.206:3091"], "framed": true}}
+}`,
+		"config.ini": `
+runmode = dev
+
+[server]
+serverport = 8205
+servermode = http
+weight = 0.5
+
+[thriftpool.upserver]
+hosts = [10.0.0.206:3091]
+framed = true
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	jsonConfig, err := LoadJsonConfig(filepath.Join(dir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iniConfig, err := LoadIniConfig(filepath.Join(dir, "config.ini"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, config := range []Configer{jsonConfig, iniConfig} {
+		if port, err := config.Int("server::serverport"); err != nil || port != 8205 {
+			t.Errorf("%T server::serverport got %d %v", config, port, err)
+		}
+		if mode, err := config.String("server::servermode"); err != nil || mode != "http" {
+			t.Errorf("%T server::servermode got %s %v", config, mode, err)
+		}
+		if weight, err := config.Float("server::weight"); err != nil || weight != 0.5 {
+			t.Errorf("%T server::weight got %v %v", config, weight, err)
+		}
+		hosts, err := config.Strings("thriftpool::upserver::hosts")
+		if err != nil || len(hosts) != 1 || hosts[0] != "10.0.0.206:3091" {
+			t.Errorf("%T thriftpool::upserver::hosts got %v %v", config, hosts, err)
+		}
+		if framed, err := config.Bool("thriftpool::upserver::framed"); err != nil || !framed {
+			t.Errorf("%T thriftpool::upserver::framed got %v %v", config, framed, err)
+		}
+	}
+
+	if runmode, _ := iniConfig.String("runmode"); runmode != "dev" {
+		t.Errorf("runmode got %s", runmode)
+	}
+}
+
+func TestIniConfigKeepString(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"config.ini": `
+[feature]
+mode = off
+enabled = no
+filemode = 0755
+version = 1.10
+port = 8205
+weight = 0.5
+debug = true
+name = "a, b"
+tags = ["x", 1.10, 3]
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	config, err := LoadIniConfig(filepath.Join(dir, "config.ini"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	feature, err := config.Map("feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"mode":     "off",
+		"enabled":  "no",
+		"filemode": "0755",
+		"version":  "1.10",
+		"port":     8205,
+		"weight":   0.5,
+		"debug":    true,
+		"name":     "a, b",
+	}
+	for key, value := range expected {
+		if feature[key] != value {
+			t.Errorf("feature::%s got %#v, expect %#v", key, feature[key], value)
+		}
+	}
+	tags, _ := feature["tags"].([]interface{})
+	if len(tags) != 3 || tags[0] != "x" || tags[1] != "1.10" || tags[2] != 3 {
+		t.Errorf("feature::tags got %#v", feature["tags"])
+	}
+}
+
+func TestLoadLayeredConfigFormat(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"config.ini":  "[server]\nserverport = 8205\n",
+		"config.toml": "",
+	})
+	defer os.RemoveAll(dir)
+
+	config, err := LoadLayeredConfig(filepath.Join(dir, "config.ini"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := config.(*IniConfig); !ok {
+		t.Errorf("got %T", config)
+	}
+	if _, err := LoadLayeredConfig(filepath.Join(dir, "config.toml"), ""); err == nil {
+		t.Error("toml should not be supported")
+	}
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+// ini的配置文件的一种实现
+//
+// section 按 `.` 或者 `::` 分割表示层级, 如 `[mysql.default]` 下的 `dsn`
+// 对应的key为 `mysql::default::dsn`, 默认section下的key直接位于顶层
+// `8205` 为int, `0.5` 为float, `true`/`false` 为bool, 逗号分割的 `[a, b]` 为列表,
+// 其它的值(包括 `no` `off` `0755` `1.10`)都保留为字符串
+type IniConfig struct {
+	*treeConfig
+}
+
+func NewIniConfig(filename string) Configer {
+	iniConfig, err := LoadIniConfig(filename)
+	if err != nil {
+		panic(err)
+	}
+	return iniConfig
+}
+
+// 读取ini配置文件, 出错时返回error
+func LoadIniConfig(filename string) (*IniConfig, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	data, err := parseIni(content)
+	if err != nil {
+		return nil, err
+	}
+	return &IniConfig{
+		treeConfig: newTreeConfig(data, filename),
+	}, nil
+}
+
+func parseIni(content []byte) (interface{}, error) {
+	file, err := ini.Load(content)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]interface{}{}
+	for _, section := range file.Sections() {
+		node := data
+		if section.Name() != ini.DEFAULT_SECTION {
+			name := strings.Replace(section.Name(), "::", ".", -1)
+			for _, part := range strings.Split(name, ".") {
+				child, ok := node[part].(map[string]interface{})
+				if !ok {
+					child = map[string]interface{}{}
+					node[part] = child
+				}
+				node = child
+			}
+		}
+		for _, key := range section.Keys() {
+			node[key.Name()] = parseIniValue(key.Value())
+		}
+	}
+	return data, nil
+}
+
+// 只接受标量与 `[a, b]` 形式的列表, 其它情况按字符串处理
+func parseIniValue(value string) interface{} {
+	trimmed := strings.TrimSpace(value)
+	if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+		trimmed = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+		items := []interface{}{}
+		if trimmed == "" {
+			return items
+		}
+		for _, item := range strings.Split(trimmed, ",") {
+			items = append(items, parseIniValue(item))
+		}
+		return items
+	}
+
+	if len(trimmed) >= 2 && (trimmed[0] == '"' || trimmed[0] == '\'') && trimmed[len(trimmed)-1] == trimmed[0] {
+		// 去掉引号
+		return trimmed[1 : len(trimmed)-1]
+	}
+	switch trimmed {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	// 只有转换回字符串后不变的数字才按数字处理, 避免 `0755` `1.10` 这类值被改写
+	if i, err := strconv.Atoi(trimmed); err == nil && strconv.Itoa(i) == trimmed {
+		return i
+	}
+	if f, err := strconv.ParseFloat(trimmed, 64); err == nil && strconv.FormatFloat(f, 'f', -1, 64) == trimmed {
+		return f
+	}
+	return trimmed
+}
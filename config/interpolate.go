@@ -0,0 +1,139 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// 支持变量替换的配置
+//
+// 配置中的字符串可以引用环境变量与其它的配置, 如
+//
+//	dsn: "${DB_USER}:${DB_PASS}@tcp(${mysql::host})/app"
+//	port: "${PORT:-8205}"
+//
+// + `${NAME}` 不包含 `::` 时优先读取环境变量, 环境变量不存在时读取顶层的配置
+// + `${a::b}` 读取其它的配置, 被引用的配置同样会被替换, 循环引用时返回错误
+// + `${NAME:-default}` 都不存在时使用默认值, 没有默认值时返回错误
+// + `$$` 表示 `$` 本身
+type InterpolateConfig struct {
+	*transformConfig
+}
+
+func NewInterpolateConfig(inner Configer) Configer {
+	config := &InterpolateConfig{}
+	config.transformConfig = &transformConfig{
+		inner: inner,
+		match: func(raw interface{}) bool {
+			return matchString(raw, func(s string) bool {
+				return strings.Contains(s, "$")
+			})
+		},
+		transform: func(key string, raw interface{}) (interface{}, error) {
+			return config.expandValue(key, raw, []string{key})
+		},
+	}
+	return config
+}
+
+func (config *InterpolateConfig) expandValue(key string, raw interface{}, stack []string) (interface{}, error) {
+	switch value := raw.(type) {
+	case string:
+		return config.expandString(key, value, stack)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			childKey := key + "::" + k
+			expanded, err := config.expandValue(childKey, v, append(stack, childKey))
+			if err != nil {
+				return nil, err
+			}
+			out[k] = expanded
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, 0, len(value))
+		for i, v := range value {
+			expanded, err := config.expandValue(fmt.Sprintf("%s::%d", key, i), v, stack)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, expanded)
+		}
+		return out, nil
+	default:
+		return raw, nil
+	}
+}
+
+func (config *InterpolateConfig) expandString(key string, s string, stack []string) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 >= len(s) {
+			buf.WriteByte(s[i])
+			continue
+		}
+		switch s[i+1] {
+		case '$':
+			buf.WriteByte('$')
+			i++
+		case '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("config %s: unclosed ${ in %q", key, s)
+			}
+			value, err := config.resolve(key, s[i+2:i+2+end], stack)
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(value)
+			i += end + 2
+		default:
+			buf.WriteByte(s[i])
+		}
+	}
+	return buf.String(), nil
+}
+
+// 解析 `${...}` 中的内容
+func (config *InterpolateConfig) resolve(key string, expr string, stack []string) (string, error) {
+	name, def, hasDefault := expr, "", false
+	if index := strings.Index(expr, ":-"); index >= 0 {
+		name, def, hasDefault = expr[:index], expr[index+2:], true
+	}
+	name = strings.TrimSpace(name)
+
+	if !strings.Contains(name, "::") {
+		if value, ok := os.LookupEnv(name); ok {
+			return value, nil
+		}
+	}
+
+	for _, k := range stack {
+		if k == name {
+			return "", fmt.Errorf("config %s: reference cycle %s -> %s",
+				key, strings.Join(stack, " -> "), name)
+		}
+	}
+	if raw, err := config.inner.Value(name); err == nil {
+		expanded, err := config.expandValue(name, raw, append(stack, name))
+		if err != nil {
+			return "", err
+		}
+		switch expanded.(type) {
+		case map[string]interface{}, []interface{}:
+			return "", fmt.Errorf("config %s: reference %s is not a scalar", key, name)
+		}
+		return fmt.Sprint(expanded), nil
+	}
+
+	if hasDefault {
+		return def, nil
+	}
+	return "", fmt.Errorf("config %s: ${%s} is not defined", key, name)
+}
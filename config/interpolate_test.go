@@ -0,0 +1,56 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestInterpolateConfig(t *testing.T) {
+	os.Setenv("MONICA_TEST_DB_USER", "root")
+	defer os.Unsetenv("MONICA_TEST_DB_USER")
+
+	config := NewInterpolateConfig(newTestYamlConfig(t, `
+mysql:
+    host: "127.0.0.1:${MONICA_TEST_DB_PORT:-3306}"
+    default:
+        dsn: "${MONICA_TEST_DB_USER}:${MONICA_TEST_DB_PASS:-}@tcp(${mysql::host})/app"
+        maxIdle: "${MONICA_TEST_MAX_IDLE:-5}"
+server:
+    serverport: 8205
+    price: "$$10"
+cycle:
+    a: "${cycle::b}"
+    b: "x${cycle::a}"
+missing: "${MONICA_TEST_NOT_EXIST}"
+`))
+
+	dsn, err := config.String("mysql::default::dsn")
+	if err != nil || dsn != "root:@tcp(127.0.0.1:3306)/app" {
+		t.Errorf("mysql::default::dsn got %s %v", dsn, err)
+	}
+	if maxIdle, err := config.Int("mysql::default::maxIdle"); err != nil || maxIdle != 5 {
+		t.Errorf("mysql::default::maxIdle got %d %v", maxIdle, err)
+	}
+	if port, err := config.Int("server::serverport"); err != nil || port != 8205 {
+		t.Errorf("server::serverport got %d %v", port, err)
+	}
+	if price, _ := config.String("server::price"); price != "$10" {
+		t.Errorf("server::price got %s", price)
+	}
+
+	mysql, err := config.Map("mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mysql["default"].(map[string]interface{})["dsn"] != dsn {
+		t.Errorf("mysql got %v", mysql)
+	}
+
+	if _, err := config.String("cycle::a"); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("cycle::a got %v", err)
+	}
+	if _, err := config.String("missing"); err == nil {
+		t.Error("missing should fail")
+	}
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+)
+
+// json的配置文件的一种实现
+type JsonConfig struct {
+	*treeConfig
+}
+
+func NewJsonConfig(filename string) Configer {
+	jsonConfig, err := LoadJsonConfig(filename)
+	if err != nil {
+		panic(err)
+	}
+	return jsonConfig
+}
+
+// 读取json配置文件, 出错时返回error
+func LoadJsonConfig(filename string) (*JsonConfig, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	data, err := parseJson(content)
+	if err != nil {
+		return nil, err
+	}
+	return &JsonConfig{
+		treeConfig: newTreeConfig(data, filename),
+	}, nil
+}
+
+func parseJson(content []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var data interface{}
+	if err := decoder.Decode(&data); err != nil {
+		return nil, err
+	}
+	return convertJsonValue(data), nil
+}
+
+// json中的数字统一转换为 int 或 float64, 与yaml解析的结果保持一致
+func convertJsonValue(in interface{}) interface{} {
+	switch value := in.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil && int64(int(i)) == i {
+			return int(i)
+		}
+		f, _ := value.Float64()
+		return f
+	case map[string]interface{}:
+		for k, v := range value {
+			value[k] = convertJsonValue(v)
+		}
+		return value
+	case []interface{}:
+		for i, v := range value {
+			value[i] = convertJsonValue(v)
+		}
+		return value
+	default:
+		return value
+	}
+}
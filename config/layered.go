@@ -0,0 +1,254 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 配置文件中用于引入其它配置文件的key
+const IncludeKey = "include"
+
+// 配置文件的格式, 根据文件的扩展名选择
+type fileFormat struct {
+	parse func(content []byte) (interface{}, error)
+	wrap  func(tree *treeConfig) Configer
+}
+
+var fileFormats = map[string]*fileFormat{
+	".yaml": yamlFormat,
+	".yml":  yamlFormat,
+	".json": {
+		parse: parseJson,
+		wrap:  func(tree *treeConfig) Configer { return &JsonConfig{tree} },
+	},
+	".ini":  iniFormat,
+	".conf": iniFormat,
+}
+
+var (
+	yamlFormat = &fileFormat{
+		parse: parseYaml,
+		wrap:  func(tree *treeConfig) Configer { return &YamlConfig{tree} },
+	}
+	iniFormat = &fileFormat{
+		parse: parseIni,
+		wrap:  func(tree *treeConfig) Configer { return &IniConfig{tree} },
+	}
+)
+
+func getFileFormat(filename string) (*fileFormat, error) {
+	format, ok := fileFormats[strings.ToLower(filepath.Ext(filename))]
+	if !ok {
+		return nil, fmt.Errorf("not support config file format: %s", filename)
+	}
+	return format, nil
+}
+
+// 读取分层的配置, 根据文件扩展名返回 YamlConfig, JsonConfig 或者 IniConfig
+//
+// 1. 读取基础配置文件 如 config.yaml
+// 2. 根据runmode读取覆盖的配置文件 如 config.prod.yaml, 深度合并到基础配置之上
+//
+// runmode为空时依次从环境变量 `MONICA_RUNMODE` 与基础配置中的 `runmode` 读取
+// 每个配置文件都可以通过 `include` 引入其它的配置文件, 路径相对于当前文件,
+// 当前文件中的配置会覆盖引入的配置, 引入的文件可以是不同的格式
+func LoadLayeredConfig(filename string, runmode string) (Configer, error) {
+	format, err := getFileFormat(filename)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := loadLayered(filename, runmode)
+	if err != nil {
+		return nil, err
+	}
+	return format.wrap(tree), nil
+}
+
+// 读取分层的yaml配置, 详见 LoadLayeredConfig
+func LoadLayeredYamlConfig(filename string, runmode string) (*YamlConfig, error) {
+	tree, err := loadLayered(filename, runmode)
+	if err != nil {
+		return nil, err
+	}
+	return &YamlConfig{tree}, nil
+}
+
+func loadLayered(filename string, runmode string) (*treeConfig, error) {
+	loader := &layeredLoader{
+		source:  SourceFile,
+		sources: map[string]string{},
+	}
+	data, err := loader.load(filename, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if runmode == "" {
+		runmode = os.Getenv(DefaultEnvPrefix + "_RUNMODE")
+	}
+	if runmode == "" {
+		if m, ok := data.(map[string]interface{}); ok {
+			runmode, _ = m["runmode"].(string)
+		}
+	}
+
+	if runmode != "" {
+		overlayFile := overlayFileName(filename, runmode)
+		if _, err := os.Stat(overlayFile); err == nil {
+			loader.source = SourceOverlay
+			overlay, err := loader.load(overlayFile, nil)
+			if err != nil {
+				return nil, err
+			}
+			data = mergeValue(data, overlay)
+		} else {
+			// 覆盖文件不存在时也需要监听, 以便文件创建后重新加载
+			loader.files = append(loader.files, overlayFile)
+		}
+	}
+
+	tree := newTreeConfig(data, loader.files...)
+	tree.sources = loader.sources
+	return tree, nil
+}
+
+// config.yaml 在runmode为prod时对应的覆盖文件为 config.prod.yaml
+func overlayFileName(filename string, runmode string) string {
+	ext := filepath.Ext(filename)
+	return fmt.Sprintf("%s.%s%s", strings.TrimSuffix(filename, ext), runmode, ext)
+}
+
+// 配置值的来源
+const (
+	SourceFile    = "file"
+	SourceOverlay = "overlay"
+	SourceEnv     = "env"
+)
+
+type layeredLoader struct {
+	// 所有读取过的文件
+	files []string
+	// 当前读取的文件的来源 SourceFile 或者 SourceOverlay
+	source string
+	// 每个叶子节点的来源, 如 `server::serverport` => `overlay config.prod.yaml`
+	sources map[string]string
+}
+
+// 读取一个配置文件并处理include, stack为正在处理的文件, 用于检查循环引用
+func (loader *layeredLoader) load(filename string, stack []string) (interface{}, error) {
+	absName, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range stack {
+		if name == absName {
+			return nil, fmt.Errorf("config include cycle: %s -> %s",
+				strings.Join(stack, " -> "), absName)
+		}
+	}
+	stack = append(stack, absName)
+	loader.files = append(loader.files, filename)
+
+	format, err := getFileFormat(filename)
+	if err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	data, err := format.parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s error: %s", filename, err)
+	}
+
+	m, ok := data.(map[string]interface{})
+	if !ok {
+		return data, nil
+	}
+	includes, err := includeFiles(filename, m[IncludeKey])
+	if err != nil {
+		return nil, err
+	}
+	delete(m, IncludeKey)
+
+	var merged interface{} = map[string]interface{}{}
+	for _, include := range includes {
+		included, err := loader.load(include, stack)
+		if err != nil {
+			return nil, err
+		}
+		merged = mergeValue(merged, included)
+	}
+	loader.recordSources("", m, fmt.Sprintf("%s %s", loader.source, filename))
+	return mergeValue(merged, m), nil
+}
+
+// 记录value中每个叶子节点的来源, 后读取的文件会覆盖之前的记录
+func (loader *layeredLoader) recordSources(prefix string, value interface{}, source string) {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		loader.sources[prefix] = source
+		return
+	}
+	for k, v := range m {
+		key := k
+		if prefix != "" {
+			key = prefix + "::" + k
+		}
+		loader.recordSources(key, v, source)
+	}
+}
+
+// include 可以是一个字符串也可以是一个字符串列表
+func includeFiles(filename string, include interface{}) ([]string, error) {
+	var names []string
+	switch value := include.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		names = []string{value}
+	case []interface{}:
+		for _, item := range value {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: include must be a list of file name", filename)
+			}
+			names = append(names, name)
+		}
+	default:
+		return nil, fmt.Errorf("%s: include must be a file name or a list of file name", filename)
+	}
+
+	dir := filepath.Dir(filename)
+	for i, name := range names {
+		if !filepath.IsAbs(name) {
+			names[i] = filepath.Join(dir, name)
+		}
+	}
+	return names, nil
+}
+
+// 深度合并, map按key递归合并, 其它类型的值直接用override覆盖
+func mergeValue(base, override interface{}) interface{} {
+	baseMap, ok := base.(map[string]interface{})
+	if !ok {
+		return override
+	}
+	overrideMap, ok := override.(map[string]interface{})
+	if !ok {
+		return override
+	}
+	merged := copyMap(baseMap)
+	for key, value := range overrideMap {
+		if old, ok := merged[key]; ok {
+			merged[key] = mergeValue(old, value)
+		} else {
+			merged[key] = value
+		}
+	}
+	return merged
+}
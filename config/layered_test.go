@@ -0,0 +1,93 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "monica_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(filename), 0755)
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadLayeredYamlConfig(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"config.yaml": `
+include: common/log.yaml
+runmode: prod
+server:
+    serverport: 8205
+    servermode: http
+`,
+		"config.prod.yaml": `
+server:
+    serverport: 80
+log:
+    level: info
+`,
+		"common/log.yaml": `
+log:
+    level: debug
+    file: log/app.log
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	config, err := LoadLayeredYamlConfig(filepath.Join(dir, "config.yaml"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port, _ := config.Int("server::serverport"); port != 80 {
+		t.Errorf("server::serverport got %d", port)
+	}
+	if mode, _ := config.String("server::servermode"); mode != "http" {
+		t.Errorf("server::servermode got %s", mode)
+	}
+	if level, _ := config.String("log::level"); level != "info" {
+		t.Errorf("log::level got %s", level)
+	}
+	if file, _ := config.String("log::file"); file != "log/app.log" {
+		t.Errorf("log::file got %s", file)
+	}
+	if _, err := config.Value("include"); err == nil {
+		t.Error("include should be removed")
+	}
+	if len(config.Files()) != 3 {
+		t.Errorf("files got %v", config.Files())
+	}
+
+	config, err = LoadLayeredYamlConfig(filepath.Join(dir, "config.yaml"), "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port, _ := config.Int("server::serverport"); port != 8205 {
+		t.Errorf("server::serverport got %d in dev", port)
+	}
+}
+
+func TestLoadLayeredYamlConfigCycle(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"config.yaml": "include: [a.yaml]\n",
+		"a.yaml":      "include: b.yaml\n",
+		"b.yaml":      "include: a.yaml\n",
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := LoadLayeredYamlConfig(filepath.Join(dir, "config.yaml"), "")
+	if err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 内存中的配置, 主要用于测试
+//
+//	config.GlobalConfiger = config.NewMapConfig(map[string]interface{}{
+//		"server": map[string]interface{}{"serverport": 8205},
+//	})
+//
+// 值可以是任意的map, slice与标量, 会被转换为与配置文件相同的树形结构
+// Set 与读取可以并发进行, Set 不会影响已经读取到的map
+type MapConfig struct {
+	// setLock 保证同一时间只有一个Set在进行
+	setLock sync.Mutex
+	current atomic.Value
+}
+
+func NewMapConfig(data map[string]interface{}) *MapConfig {
+	config := &MapConfig{}
+	tree := normalizeValue(data)
+	if tree == nil {
+		tree = map[string]interface{}{}
+	}
+	config.current.Store(newTreeConfig(tree))
+	return config
+}
+
+func (config *MapConfig) tree() *treeConfig {
+	return config.current.Load().(*treeConfig)
+}
+
+// 设置key对应的值, 中间的map不存在时自动创建, value为nil时删除该key
+func (config *MapConfig) Set(key string, value interface{}) {
+	config.setLock.Lock()
+	defer config.setLock.Unlock()
+
+	root, _ := config.tree().data.(map[string]interface{})
+	root = copyMap(root)
+	m := root
+	names := strings.Split(key, "::")
+	for _, name := range names[:len(names)-1] {
+		child, ok := m[name].(map[string]interface{})
+		if ok {
+			child = copyMap(child)
+		} else {
+			child = map[string]interface{}{}
+		}
+		m[name] = child
+		m = child
+	}
+	last := names[len(names)-1]
+	if value == nil {
+		delete(m, last)
+	} else {
+		m[last] = normalizeValue(value)
+	}
+	config.current.Store(newTreeConfig(root))
+}
+
+// 将任意的map与slice递归转换为 map[string]interface{} 与 []interface{}
+func normalizeValue(in interface{}) interface{} {
+	if in == nil {
+		return nil
+	}
+	switch value := in.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			out[k] = normalizeValue(v)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, 0, len(value))
+		for _, v := range value {
+			out = append(out, normalizeValue(v))
+		}
+		return out
+	case string, bool, int, float64:
+		return value
+	case time.Duration:
+		return value.String()
+	}
+
+	rv := reflect.ValueOf(in)
+	switch rv.Kind() {
+	case reflect.Map:
+		out := make(map[string]interface{}, rv.Len())
+		for _, k := range rv.MapKeys() {
+			out[fmt.Sprint(k.Interface())] = normalizeValue(rv.MapIndex(k).Interface())
+		}
+		return out
+	case reflect.Slice, reflect.Array:
+		out := make([]interface{}, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			out = append(out, normalizeValue(rv.Index(i).Interface()))
+		}
+		return out
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(rv.Uint())
+	case reflect.Float32:
+		return rv.Float()
+	}
+	return in
+}
+
+func (config *MapConfig) String(key string) (string, error) {
+	return config.tree().String(key)
+}
+
+func (config *MapConfig) Strings(key string) ([]string, error) {
+	return config.tree().Strings(key)
+}
+
+func (config *MapConfig) Int(key string) (int, error) {
+	return config.tree().Int(key)
+}
+
+func (config *MapConfig) Ints(key string) ([]int, error) {
+	return config.tree().Ints(key)
+}
+
+func (config *MapConfig) Float(key string) (float64, error) {
+	return config.tree().Float(key)
+}
+
+func (config *MapConfig) Floats(key string) ([]float64, error) {
+	return config.tree().Floats(key)
+}
+
+func (config *MapConfig) Bool(key string) (bool, error) {
+	return config.tree().Bool(key)
+}
+
+func (config *MapConfig) Bools(key string) ([]bool, error) {
+	return config.tree().Bools(key)
+}
+
+func (config *MapConfig) Duration(key string) (time.Duration, error) {
+	return config.tree().Duration(key)
+}
+
+func (config *MapConfig) Size(key string) (ByteSize, error) {
+	return config.tree().Size(key)
+}
+
+func (config *MapConfig) Map(key string) (map[string]interface{}, error) {
+	return config.tree().Map(key)
+}
+
+func (config *MapConfig) Maps(key string) ([]map[string]interface{}, error) {
+	return config.tree().Maps(key)
+}
+
+func (config *MapConfig) Value(key string) (interface{}, error) {
+	return config.tree().Value(key)
+}
+
+func (config *MapConfig) Has(key string) bool {
+	return hasKey(config, key)
+}
+
+func (config *MapConfig) Keys(key string) ([]string, error) {
+	return mapKeys(config, key)
+}
+
+func (config *MapConfig) Sub(key string) Configer {
+	return newSubConfig(config, key)
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMapConfig(t *testing.T) {
+	config := NewMapConfig(map[string]interface{}{
+		"server": map[string]interface{}{
+			"serverport": 8205,
+			"servermode": "http",
+		},
+		"thriftpool": map[string]map[string]interface{}{
+			"upserver": {
+				"hosts":         []string{"a:1", "b:2"},
+				"retry_backoff": 2 * time.Second,
+				"max_idle":      uint8(20),
+			},
+		},
+	})
+
+	if port, err := config.Int("server::serverport"); err != nil || port != 8205 {
+		t.Errorf("server::serverport got %d %v", port, err)
+	}
+	if hosts, err := config.Strings("thriftpool::upserver::hosts"); err != nil || len(hosts) != 2 {
+		t.Errorf("hosts got %v %v", hosts, err)
+	}
+	if backoff, err := config.Duration("thriftpool::upserver::retry_backoff"); err != nil || backoff != 2*time.Second {
+		t.Errorf("retry_backoff got %v %v", backoff, err)
+	}
+	if maxIdle, err := config.Int("thriftpool::upserver::max_idle"); err != nil || maxIdle != 20 {
+		t.Errorf("max_idle got %v %v", maxIdle, err)
+	}
+
+	server, _ := config.Map("server")
+	config.Set("server::serverport", 80)
+	config.Set("mysql::default::dsn", "root@/app")
+	config.Set("server::servermode", nil)
+
+	if server["serverport"] != 8205 {
+		t.Errorf("map read before Set should not change, got %v", server)
+	}
+	if port, err := config.Int("server::serverport"); err != nil || port != 80 {
+		t.Errorf("server::serverport got %d %v", port, err)
+	}
+	if dsn, err := config.String("mysql::default::dsn"); err != nil || dsn != "root@/app" {
+		t.Errorf("mysql::default::dsn got %s %v", dsn, err)
+	}
+	if config.Has("server::servermode") {
+		t.Error("server::servermode should be deleted")
+	}
+}
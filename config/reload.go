@@ -0,0 +1,287 @@
+package config
+
+import (
+	"log"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 默认的配置文件检查间隔
+const DefaultWatchInterval = 5 * time.Second
+
+// 配置变更时的回调函数, old/new 为变更前后key对应的原始值, key不存在时为nil
+type ChangeFunc func(old, new interface{})
+
+var (
+	subscribersLock sync.RWMutex
+	subscribers     = map[string][]ChangeFunc{}
+)
+
+// 注册配置变更的回调, 如 OnChange("thriftpool::upserver", func(old, new interface{}) {...})
+// 配置重新加载后, key对应的值发生变化时会调用回调函数
+func OnChange(key string, fn ChangeFunc) {
+	subscribersLock.Lock()
+	defer subscribersLock.Unlock()
+	subscribers[key] = append(subscribers[key], fn)
+}
+
+// 配置的校验函数, 返回错误时拒绝新的配置
+type ValidateFunc func(configer Configer) error
+
+var (
+	validatorsLock sync.RWMutex
+	validators     []ValidateFunc
+)
+
+// 注册配置的校验函数, 重新加载配置时新的配置需要通过所有的校验才会生效
+func RegisterValidator(fn ValidateFunc) {
+	validatorsLock.Lock()
+	defer validatorsLock.Unlock()
+	validators = append(validators, fn)
+}
+
+func validate(configer Configer) error {
+	validatorsLock.RLock()
+	defer validatorsLock.RUnlock()
+	for _, fn := range validators {
+		if err := fn(configer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 全局配置的重新加载函数, 见 SetGlobalReload
+var globalReload atomic.Value
+
+// 设置全局配置的重新加载函数, 设置之后全局配置的 Reload 与文件变化都会调用它
+// 如 monica 设置为 monica.Reload, 重新加载配置的同时重建logger,
+// reload 中需要调用 Load 与 Apply, 而不是 Reload
+func SetGlobalReload(reload func() error) {
+	globalReload.Store(reload)
+}
+
+// 重新加载全局配置
+func Reload() error {
+	if reloadable, ok := GlobalConfiger.(*ReloadableConfig); ok {
+		return reloadable.Reload()
+	}
+	return nil
+}
+
+// 回调在锁外调用, 回调中可以再调用 OnChange
+func notifyChange(old, new Configer) {
+	subscribersLock.RLock()
+	current := make(map[string][]ChangeFunc, len(subscribers))
+	for key, fns := range subscribers {
+		current[key] = fns
+	}
+	subscribersLock.RUnlock()
+	for key, fns := range current {
+		oldValue, _ := old.Value(key)
+		newValue, _ := new.Value(key)
+		if reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		for _, fn := range fns {
+			fn(oldValue, newValue)
+		}
+	}
+}
+
+// 可以重新加载的配置
+// 重新加载时调用loader生成新的配置, 并原子的替换掉旧的配置
+type ReloadableConfig struct {
+	loader  func() (Configer, error)
+	current atomic.Value
+	// reloadLock 保证同一时间只有一个reload在进行
+	reloadLock sync.Mutex
+	stop       chan struct{}
+}
+
+func NewReloadableConfig(loader func() (Configer, error)) (*ReloadableConfig, error) {
+	configer, err := loader()
+	if err != nil {
+		return nil, err
+	}
+	config := &ReloadableConfig{
+		loader: loader,
+	}
+	config.current.Store(configer)
+	return config, nil
+}
+
+// 当前生效的配置
+func (config *ReloadableConfig) Current() Configer {
+	return config.current.Load().(Configer)
+}
+
+// 重新加载配置, 加载失败或者没有通过校验时保留原有的配置
+// 作为全局配置并且设置了 SetGlobalReload 时调用设置的函数
+func (config *ReloadableConfig) Reload() error {
+	if reload, ok := globalReload.Load().(func() error); ok && GlobalConfiger == Configer(config) {
+		return reload()
+	}
+	config.reloadLock.Lock()
+	defer config.reloadLock.Unlock()
+	configer, err := config.Load()
+	if err != nil {
+		return err
+	}
+	config.Apply(configer)
+	return nil
+}
+
+// 加载新的配置并校验, 但不生效
+// 用于在新的配置生效之前根据它做其他的准备, 准备好之后调用 Apply
+func (config *ReloadableConfig) Load() (Configer, error) {
+	configer, err := config.loader()
+	if err != nil {
+		return nil, err
+	}
+	if err := validate(configer); err != nil {
+		return nil, err
+	}
+	return configer, nil
+}
+
+// 用 Load 返回的配置替换当前的配置, 并通知 OnChange 注册的回调
+func (config *ReloadableConfig) Apply(configer Configer) {
+	old := config.Current()
+	config.current.Store(configer)
+	notifyChange(old, configer)
+}
+
+// 定期检查文件的修改时间, 文件变化时重新加载配置
+func (config *ReloadableConfig) WatchFile(filename string, interval time.Duration) {
+	config.WatchFiles(interval, func() []string {
+		return []string{filename}
+	})
+}
+
+// 定期检查files返回的所有文件的修改时间, 任一文件变化时重新加载配置
+// files 在每次检查时都会调用, 以便重新加载后监听新引入的文件
+func (config *ReloadableConfig) WatchFiles(interval time.Duration, files func() []string) {
+	config.reloadLock.Lock()
+	if config.stop != nil {
+		close(config.stop)
+	}
+	stop := make(chan struct{})
+	config.stop = stop
+	config.reloadLock.Unlock()
+
+	lastModify := filesModifyTime(files())
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			modify := filesModifyTime(files())
+			if reflect.DeepEqual(modify, lastModify) {
+				continue
+			}
+			if err := config.Reload(); err != nil {
+				log.Println("WARNING: reload config error, keep the old one", err)
+				lastModify = modify
+				continue
+			}
+			// 重新加载后文件列表可能发生变化
+			lastModify = filesModifyTime(files())
+			log.Println("INFO: config reloaded")
+		}
+	}()
+}
+
+// 停止监听文件
+func (config *ReloadableConfig) StopWatch() {
+	config.reloadLock.Lock()
+	defer config.reloadLock.Unlock()
+	if config.stop != nil {
+		close(config.stop)
+		config.stop = nil
+	}
+}
+
+// 文件的修改时间, 文件不存在时为零值
+func filesModifyTime(filenames []string) map[string]time.Time {
+	modify := make(map[string]time.Time, len(filenames))
+	for _, filename := range filenames {
+		if info, err := os.Stat(filename); err == nil {
+			modify[filename] = info.ModTime()
+		} else {
+			modify[filename] = time.Time{}
+		}
+	}
+	return modify
+}
+
+func (config *ReloadableConfig) String(key string) (string, error) {
+	return config.Current().String(key)
+}
+
+func (config *ReloadableConfig) Strings(key string) ([]string, error) {
+	return config.Current().Strings(key)
+}
+
+func (config *ReloadableConfig) Int(key string) (int, error) {
+	return config.Current().Int(key)
+}
+
+func (config *ReloadableConfig) Ints(key string) ([]int, error) {
+	return config.Current().Ints(key)
+}
+
+func (config *ReloadableConfig) Float(key string) (float64, error) {
+	return config.Current().Float(key)
+}
+
+func (config *ReloadableConfig) Floats(key string) ([]float64, error) {
+	return config.Current().Floats(key)
+}
+
+func (config *ReloadableConfig) Bool(key string) (bool, error) {
+	return config.Current().Bool(key)
+}
+
+func (config *ReloadableConfig) Bools(key string) ([]bool, error) {
+	return config.Current().Bools(key)
+}
+
+func (config *ReloadableConfig) Duration(key string) (time.Duration, error) {
+	return config.Current().Duration(key)
+}
+
+func (config *ReloadableConfig) Size(key string) (ByteSize, error) {
+	return config.Current().Size(key)
+}
+
+func (config *ReloadableConfig) Map(key string) (map[string]interface{}, error) {
+	return config.Current().Map(key)
+}
+
+func (config *ReloadableConfig) Maps(key string) ([]map[string]interface{}, error) {
+	return config.Current().Maps(key)
+}
+
+func (config *ReloadableConfig) Value(key string) (interface{}, error) {
+	return config.Current().Value(key)
+}
+
+func (config *ReloadableConfig) Has(key string) bool {
+	return hasKey(config, key)
+}
+
+func (config *ReloadableConfig) Keys(key string) ([]string, error) {
+	return mapKeys(config, key)
+}
+
+func (config *ReloadableConfig) Sub(key string) Configer {
+	return newSubConfig(config, key)
+}
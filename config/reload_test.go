@@ -0,0 +1,152 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReloadableConfig(t *testing.T) {
+	f, err := ioutil.TempFile("", "monica_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(testYaml)
+	f.Close()
+
+	reloadable, err := NewReloadableConfig(func() (Configer, error) {
+		return LoadYamlConfig(f.Name())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		subscribers = map[string][]ChangeFunc{}
+	}()
+
+	var changed []interface{}
+	OnChange("server::serverport", func(old, new interface{}) {
+		changed = append(changed, old, new)
+	})
+	OnChange("server::servermode", func(old, new interface{}) {
+		t.Errorf("server::servermode should not change: %v %v", old, new)
+	})
+
+	ioutil.WriteFile(f.Name(), []byte("server:\n    serverport: 9000\n    servermode: http\n"), 0644)
+	if err := reloadable.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if port, _ := reloadable.Int("server::serverport"); port != 9000 {
+		t.Errorf("server::serverport got %d", port)
+	}
+	if len(changed) != 2 || changed[0] != 8205 || changed[1] != 9000 {
+		t.Errorf("change callback got %v", changed)
+	}
+
+	// 加载失败时保留原有配置
+	ioutil.WriteFile(f.Name(), []byte("server: [\n"), 0644)
+	if err := reloadable.Reload(); err == nil {
+		t.Error("reload broken file should fail")
+	}
+	if port, _ := reloadable.Int("server::serverport"); port != 9000 {
+		t.Errorf("server::serverport got %d after failed reload", port)
+	}
+
+	// 没有通过校验时保留原有配置
+	defer func() {
+		validators = nil
+	}()
+	RegisterValidator(func(configer Configer) error {
+		if port, _ := configer.Int("server::serverport"); port < 1024 {
+			return fmt.Errorf("server::serverport %d is reserved", port)
+		}
+		return nil
+	})
+	ioutil.WriteFile(f.Name(), []byte("server:\n    serverport: 80\n"), 0644)
+	if err := reloadable.Reload(); err == nil {
+		t.Error("reload invalid config should fail")
+	}
+	if port, _ := reloadable.Int("server::serverport"); port != 9000 {
+		t.Errorf("server::serverport got %d after invalid reload", port)
+	}
+}
+
+func TestOnChangeInCallback(t *testing.T) {
+	defer func() {
+		subscribers = map[string][]ChangeFunc{}
+	}()
+	OnChange("a", func(old, new interface{}) {
+		OnChange("b", func(old, new interface{}) {})
+	})
+	done := make(chan struct{})
+	go func() {
+		notifyChange(NewMapConfig(map[string]interface{}{"a": 1}), NewMapConfig(map[string]interface{}{"a": 2}))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("OnChange in a callback deadlocked")
+	}
+	if len(subscribers["b"]) != 1 {
+		t.Errorf("got %d subscribers", len(subscribers["b"]))
+	}
+}
+
+func TestWatchReload(t *testing.T) {
+	f, err := ioutil.TempFile("", "monica_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(testYaml)
+	f.Close()
+
+	reloadable, err := NewReloadableConfig(func() (Configer, error) {
+		return LoadYamlConfig(f.Name())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldConfiger := GlobalConfiger
+	GlobalConfiger = reloadable
+	defer func() {
+		GlobalConfiger = oldConfiger
+		globalReload = atomic.Value{}
+	}()
+	// 全局配置的 Reload 与文件变化都调用 SetGlobalReload 设置的函数
+	reloaded := make(chan struct{}, 1)
+	SetGlobalReload(func() error {
+		reloaded <- struct{}{}
+		configer, err := reloadable.Load()
+		if err != nil {
+			return err
+		}
+		reloadable.Apply(configer)
+		return nil
+	})
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-reloaded:
+	default:
+		t.Error("global reload is not called by Reload")
+	}
+
+	reloadable.WatchFile(f.Name(), 10*time.Millisecond)
+	defer reloadable.StopWatch()
+
+	modTime := time.Now().Add(time.Second)
+	os.Chtimes(f.Name(), modTime, modTime)
+	select {
+	case <-reloaded:
+	case <-time.After(time.Second):
+		t.Error("global reload is not called after the file changed")
+	}
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+const (
+	// 加密的配置值的前缀, 如 `enc:v1:xxxx`
+	SecretPrefix = "enc:v1:"
+	// 密钥的长度
+	SecretKeySize = 32
+	// 存放密钥的环境变量, 值为base64编码的密钥
+	SecretKeyEnv = "MONICA_CONFIG_KEY"
+	// 存放密钥文件路径的环境变量, 文件内容为base64编码的密钥
+	SecretKeyFileEnv = "MONICA_CONFIG_KEY_FILE"
+)
+
+const nonceSize = 24
+
+var ErrNoSecretKey = errors.New("config secret key not configured: set " +
+	SecretKeyEnv + " or " + SecretKeyFileEnv)
+
+// 解密配置的配置
+// 以 `enc:v1:` 开头的字符串会被透明的解密, 加密使用 nacl secretbox (XSalsa20-Poly1305)
+// `enc:v1:` 之后是base64编码的 nonce + 密文
+type SecretConfig struct {
+	*transformConfig
+	key []byte
+	// 解密后的值中的 `$` 转义为 `$$`, 外层的 InterpolateConfig 不会再对解密后的值做变量替换
+	escapeDollar bool
+}
+
+// key 为空时, 读取到加密的值会返回 ErrNoSecretKey
+func NewSecretConfig(inner Configer, key []byte) Configer {
+	config := &SecretConfig{
+		key: key,
+	}
+	config.transformConfig = &transformConfig{
+		inner: inner,
+		match: func(raw interface{}) bool {
+			return matchString(raw, IsSecretValue)
+		},
+		transform: config.decryptValue,
+	}
+	return config
+}
+
+// 用在 InterpolateConfig 之下的 SecretConfig, 解密后的值按字面量处理
+func newLiteralSecretConfig(inner Configer, key []byte) Configer {
+	config := NewSecretConfig(inner, key).(*SecretConfig)
+	config.escapeDollar = true
+	return config
+}
+
+func (config *SecretConfig) decryptValue(key string, raw interface{}) (interface{}, error) {
+	switch value := raw.(type) {
+	case string:
+		if !IsSecretValue(value) {
+			return value, nil
+		}
+		if config.key == nil {
+			return nil, fmt.Errorf("config %s: %s", key, ErrNoSecretKey)
+		}
+		plain, err := DecryptValue(config.key, value)
+		if err != nil {
+			return nil, fmt.Errorf("config %s: %s", key, err)
+		}
+		if config.escapeDollar {
+			plain = strings.Replace(plain, "$", "$$", -1)
+		}
+		return plain, nil
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			decrypted, err := config.decryptValue(key+"::"+k, v)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = decrypted
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, 0, len(value))
+		for i, v := range value {
+			decrypted, err := config.decryptValue(fmt.Sprintf("%s::%d", key, i), v)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, decrypted)
+		}
+		return out, nil
+	default:
+		return raw, nil
+	}
+}
+
+// 是否为加密的配置值
+func IsSecretValue(value string) bool {
+	return strings.HasPrefix(value, SecretPrefix)
+}
+
+// 生成一个随机的密钥
+func GenerateSecretKey() ([]byte, error) {
+	key := make([]byte, SecretKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// 将密钥编码为base64, 用于写入环境变量或者密钥文件
+func EncodeSecretKey(key []byte) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// 解析base64编码的密钥
+func DecodeSecretKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("invalid config secret key: %s", err)
+	}
+	if len(key) != SecretKeySize {
+		return nil, fmt.Errorf("invalid config secret key: need %d bytes, got %d",
+			SecretKeySize, len(key))
+	}
+	return key, nil
+}
+
+// 依次从环境变量 MONICA_CONFIG_KEY 与 MONICA_CONFIG_KEY_FILE 指定的文件中读取密钥
+// 都没有配置时返回 ErrNoSecretKey
+func LoadSecretKey() ([]byte, error) {
+	if encoded := os.Getenv(SecretKeyEnv); encoded != "" {
+		return DecodeSecretKey(encoded)
+	}
+	if keyFile := os.Getenv(SecretKeyFileEnv); keyFile != "" {
+		content, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return DecodeSecretKey(string(content))
+	}
+	return nil, ErrNoSecretKey
+}
+
+// 加密一个配置值, 返回 `enc:v1:` 开头的字符串
+func EncryptValue(key []byte, plain string) (string, error) {
+	if len(key) != SecretKeySize {
+		return "", fmt.Errorf("invalid config secret key size %d", len(key))
+	}
+	var secretKey [SecretKeySize]byte
+	copy(secretKey[:], key)
+
+	var nonce [nonceSize]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return "", err
+	}
+	sealed := secretbox.Seal(nonce[:], []byte(plain), &nonce, &secretKey)
+	return SecretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// 解密 `enc:v1:` 开头的配置值
+func DecryptValue(key []byte, value string) (string, error) {
+	if !IsSecretValue(value) {
+		return "", fmt.Errorf("not an encrypted value")
+	}
+	if len(key) != SecretKeySize {
+		return "", fmt.Errorf("invalid config secret key size %d", len(key))
+	}
+	var secretKey [SecretKeySize]byte
+	copy(secretKey[:], key)
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, SecretPrefix))
+	if err != nil || len(sealed) < nonceSize+secretbox.Overhead {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+	var nonce [nonceSize]byte
+	copy(nonce[:], sealed[:nonceSize])
+	plain, ok := secretbox.Open(nil, sealed[nonceSize:], &nonce, &secretKey)
+	if !ok {
+		return "", fmt.Errorf("decrypt value failed: wrong key or corrupted value")
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSecretConfig(t *testing.T) {
+	key, err := GenerateSecretKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := EncryptValue(key, "root:secret@tcp(db:3306)/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSecretValue(encrypted) {
+		t.Fatalf("got %s", encrypted)
+	}
+
+	decoded, err := DecodeSecretKey(EncodeSecretKey(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	yamlConfig := newTestYamlConfig(t, "mysql:\n    default:\n        dsn: \""+encrypted+"\"\n        maxIdle: 5\n")
+	config := NewSecretConfig(yamlConfig, decoded)
+
+	if dsn, err := config.String("mysql::default::dsn"); err != nil || dsn != "root:secret@tcp(db:3306)/app" {
+		t.Errorf("mysql::default::dsn got %s %v", dsn, err)
+	}
+	mysql, err := config.Map("mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mysql["default"].(map[string]interface{})["dsn"] != "root:secret@tcp(db:3306)/app" {
+		t.Errorf("mysql got %v", mysql)
+	}
+	if maxIdle, err := config.Int("mysql::default::maxIdle"); err != nil || maxIdle != 5 {
+		t.Errorf("mysql::default::maxIdle got %d %v", maxIdle, err)
+	}
+
+	otherKey, _ := GenerateSecretKey()
+	if _, err := NewSecretConfig(yamlConfig, otherKey).String("mysql::default::dsn"); err == nil {
+		t.Error("decrypt with wrong key should fail")
+	}
+	if _, err := NewSecretConfig(yamlConfig, nil).String("mysql::default::dsn"); err == nil {
+		t.Error("decrypt without key should fail")
+	}
+}
+
+func TestSecretWithDollar(t *testing.T) {
+	key, err := GenerateSecretKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := EncryptValue(key, "pa$$w0rd${x}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv(SecretKeyEnv, EncodeSecretKey(key))
+	defer os.Unsetenv(SecretKeyEnv)
+	configer, err := wrapFileConfiger(newTestYamlConfig(t, "mysql:\n    default:\n        password: \""+encrypted+
+		"\"\n        dsn: \"root:${mysql::default::password}@tcp(db)/app\"\n        plain: \"a$$b\"\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 解密后的值不做变量替换
+	if password, err := configer.String("mysql::default::password"); err != nil || password != "pa$$w0rd${x}" {
+		t.Errorf("mysql::default::password got %q %v", password, err)
+	}
+	mysql, err := configer.Map("mysql::default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mysql["password"] != "pa$$w0rd${x}" || mysql["dsn"] != "root:pa$$w0rd${x}@tcp(db)/app" || mysql["plain"] != "a$b" {
+		t.Errorf("mysql::default got %v", mysql)
+	}
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"sort"
+	"time"
+)
+
+// 子配置, 所有的key都加上prefix之后从parent中读取
+// 因此环境变量覆盖, 变量替换与热加载在子配置中同样生效
+type subConfig struct {
+	parent Configer
+	prefix string
+}
+
+func newSubConfig(parent Configer, prefix string) Configer {
+	if prefix == "" {
+		return parent
+	}
+	if sub, ok := parent.(*subConfig); ok {
+		return &subConfig{
+			parent: sub.parent,
+			prefix: sub.fullKey(prefix),
+		}
+	}
+	return &subConfig{
+		parent: parent,
+		prefix: prefix,
+	}
+}
+
+func (config *subConfig) fullKey(key string) string {
+	if key == "" {
+		return config.prefix
+	}
+	return config.prefix + "::" + key
+}
+
+// key是否存在, 值存在但读取出错(如解密失败)时也认为存在
+func hasKey(configer Configer, key string) bool {
+	_, err := configer.Value(key)
+	return !IsNotFound(err)
+}
+
+func mapKeys(configer Configer, key string) ([]string, error) {
+	m, err := configer.Map(key)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (config *subConfig) String(key string) (string, error) {
+	return config.parent.String(config.fullKey(key))
+}
+
+func (config *subConfig) Strings(key string) ([]string, error) {
+	return config.parent.Strings(config.fullKey(key))
+}
+
+func (config *subConfig) Int(key string) (int, error) {
+	return config.parent.Int(config.fullKey(key))
+}
+
+func (config *subConfig) Ints(key string) ([]int, error) {
+	return config.parent.Ints(config.fullKey(key))
+}
+
+func (config *subConfig) Float(key string) (float64, error) {
+	return config.parent.Float(config.fullKey(key))
+}
+
+func (config *subConfig) Floats(key string) ([]float64, error) {
+	return config.parent.Floats(config.fullKey(key))
+}
+
+func (config *subConfig) Bool(key string) (bool, error) {
+	return config.parent.Bool(config.fullKey(key))
+}
+
+func (config *subConfig) Bools(key string) ([]bool, error) {
+	return config.parent.Bools(config.fullKey(key))
+}
+
+func (config *subConfig) Duration(key string) (time.Duration, error) {
+	return config.parent.Duration(config.fullKey(key))
+}
+
+func (config *subConfig) Size(key string) (ByteSize, error) {
+	return config.parent.Size(config.fullKey(key))
+}
+
+func (config *subConfig) Map(key string) (map[string]interface{}, error) {
+	return config.parent.Map(config.fullKey(key))
+}
+
+func (config *subConfig) Maps(key string) ([]map[string]interface{}, error) {
+	return config.parent.Maps(config.fullKey(key))
+}
+
+func (config *subConfig) Value(key string) (interface{}, error) {
+	return config.parent.Value(config.fullKey(key))
+}
+
+func (config *subConfig) Has(key string) bool {
+	return config.parent.Has(config.fullKey(key))
+}
+
+func (config *subConfig) Keys(key string) ([]string, error) {
+	return config.parent.Keys(config.fullKey(key))
+}
+
+func (config *subConfig) Sub(key string) Configer {
+	return newSubConfig(config, key)
+}
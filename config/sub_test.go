@@ -0,0 +1,84 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestKeyError(t *testing.T) {
+	config := newTestYamlConfig(t, testYaml)
+
+	_, err := config.String("server::host")
+	if !IsNotFound(err) || !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("got %v", err)
+	}
+	if keyErr, ok := err.(*KeyError); !ok || keyErr.Key != "server::host" {
+		t.Errorf("got %#v", err)
+	}
+
+	_, err = config.Int("server::servermode")
+	if !IsTypeMismatch(err) || err.(*KeyError).Key != "server::servermode" {
+		t.Errorf("got %v", err)
+	}
+	_, err = config.Ints("thriftpool::upserver::hosts")
+	if !IsTypeMismatch(err) || err.(*KeyError).Key != "thriftpool::upserver::hosts::0" {
+		t.Errorf("got %v", err)
+	}
+
+	os.Setenv("MONICA_SERVER__SERVERPORT", "abc")
+	defer os.Unsetenv("MONICA_SERVER__SERVERPORT")
+	_, err = NewEnvConfig(DefaultEnvPrefix, config).Int("server::serverport")
+	if !IsTypeMismatch(err) || err.(*KeyError).Key != "server::serverport" {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestHasKeysSub(t *testing.T) {
+	config := NewEnvConfig(DefaultEnvPrefix, newTestYamlConfig(t, testYaml))
+
+	if !config.Has("mysql::default::dsn") || config.Has("mysql::slave") {
+		t.Error("has error")
+	}
+	keys, err := config.Keys("server")
+	if err != nil || !reflect.DeepEqual(keys, []string{"servermode", "serverport", "urlPrefix"}) {
+		t.Errorf("got %v %v", keys, err)
+	}
+	if keys, err := config.Keys(""); err != nil || len(keys) != 3 {
+		t.Errorf("got %v %v", keys, err)
+	}
+	if _, err := config.Keys("server::serverport"); !IsTypeMismatch(err) {
+		t.Errorf("got %v", err)
+	}
+
+	os.Setenv("MONICA_MYSQL__DEFAULT__MAXIDLE", "10")
+	defer os.Unsetenv("MONICA_MYSQL__DEFAULT__MAXIDLE")
+	sub := config.Sub("mysql").Sub("default")
+	if maxIdle, err := sub.Int("maxIdle"); err != nil || maxIdle != 10 {
+		t.Errorf("got %d %v", maxIdle, err)
+	}
+	if dsn, err := sub.String("dsn"); err != nil || dsn != "user:pass@tcp(127.0.0.1:3306)/app" {
+		t.Errorf("got %s %v", dsn, err)
+	}
+	if _, err := sub.String("host"); !IsNotFound(err) || err.(*KeyError).Key != "mysql::default::host" {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestStringOr(t *testing.T) {
+	defer func(old Configer) {
+		GlobalConfiger = old
+	}(GlobalConfiger)
+	GlobalConfiger = newTestYamlConfig(t, testYaml)
+
+	if StringOr("server::servermode", "fastcgi") != "http" {
+		t.Error("servermode should be http")
+	}
+	if StringOr("server::host", "localhost") != "localhost" {
+		t.Error("host should be default")
+	}
+	if IntOr("server::servermode", 80) != 80 {
+		t.Error("type mismatch should return default")
+	}
+}
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"time"
+)
+
+// 对配置中的原始值做转换的配置, 如变量替换, 解密等
+// match 判断原始值是否需要转换, 不需要时直接调用inner对应的方法,
+// 需要转换时调用transform并按 Unmarshal 的规则转换为对应的类型
+type transformConfig struct {
+	inner     Configer
+	match     func(raw interface{}) bool
+	transform func(key string, raw interface{}) (interface{}, error)
+}
+
+func (config *transformConfig) Value(key string) (interface{}, error) {
+	raw, err := config.inner.Value(key)
+	if err != nil || !config.match(raw) {
+		return raw, err
+	}
+	return config.transform(key, raw)
+}
+
+// 如果key对应的值需要转换, 转换之后解析到out中并返回true
+func (config *transformConfig) decode(key string, out interface{}) (bool, error) {
+	raw, err := config.inner.Value(key)
+	if err != nil || !config.match(raw) {
+		return false, nil
+	}
+	transformed, err := config.transform(key, raw)
+	if err != nil {
+		return true, err
+	}
+	return true, decodeKey(key, transformed, out)
+}
+
+// 判断原始值中是否有满足条件的字符串
+func matchString(raw interface{}, fn func(s string) bool) bool {
+	switch value := raw.(type) {
+	case string:
+		return fn(value)
+	case map[string]interface{}:
+		for _, v := range value {
+			if matchString(v, fn) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, v := range value {
+			if matchString(v, fn) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (config *transformConfig) String(key string) (res string, err error) {
+	if ok, err := config.decode(key, &res); ok {
+		return res, err
+	}
+	return config.inner.String(key)
+}
+
+func (config *transformConfig) Strings(key string) (res []string, err error) {
+	if ok, err := config.decode(key, &res); ok {
+		return res, err
+	}
+	return config.inner.Strings(key)
+}
+
+func (config *transformConfig) Int(key string) (res int, err error) {
+	if ok, err := config.decode(key, &res); ok {
+		return res, err
+	}
+	return config.inner.Int(key)
+}
+
+func (config *transformConfig) Ints(key string) (res []int, err error) {
+	if ok, err := config.decode(key, &res); ok {
+		return res, err
+	}
+	return config.inner.Ints(key)
+}
+
+func (config *transformConfig) Float(key string) (res float64, err error) {
+	if ok, err := config.decode(key, &res); ok {
+		return res, err
+	}
+	return config.inner.Float(key)
+}
+
+func (config *transformConfig) Floats(key string) (res []float64, err error) {
+	if ok, err := config.decode(key, &res); ok {
+		return res, err
+	}
+	return config.inner.Floats(key)
+}
+
+func (config *transformConfig) Bool(key string) (res bool, err error) {
+	if ok, err := config.decode(key, &res); ok {
+		return res, err
+	}
+	return config.inner.Bool(key)
+}
+
+func (config *transformConfig) Bools(key string) (res []bool, err error) {
+	if ok, err := config.decode(key, &res); ok {
+		return res, err
+	}
+	return config.inner.Bools(key)
+}
+
+func (config *transformConfig) Duration(key string) (res time.Duration, err error) {
+	if ok, err := config.decode(key, &res); ok {
+		return res, err
+	}
+	return config.inner.Duration(key)
+}
+
+func (config *transformConfig) Size(key string) (res ByteSize, err error) {
+	if ok, err := config.decode(key, &res); ok {
+		return res, err
+	}
+	return config.inner.Size(key)
+}
+
+func (config *transformConfig) Map(key string) (res map[string]interface{}, err error) {
+	if ok, err := config.decode(key, &res); ok {
+		return res, err
+	}
+	return config.inner.Map(key)
+}
+
+func (config *transformConfig) Maps(key string) (res []map[string]interface{}, err error) {
+	if ok, err := config.decode(key, &res); ok {
+		return res, err
+	}
+	return config.inner.Maps(key)
+}
+
+func (config *transformConfig) Has(key string) bool {
+	return hasKey(config, key)
+}
+
+func (config *transformConfig) Keys(key string) ([]string, error) {
+	return mapKeys(config, key)
+}
+
+func (config *transformConfig) Sub(key string) Configer {
+	return newSubConfig(config, key)
+}
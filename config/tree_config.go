@@ -0,0 +1,158 @@
+package config
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// 基于树形结构的配置实现
+// yaml/json/ini 等配置文件解析之后都会转换为该结构,
+// 其中 map 统一为 map[string]interface{}, 列表统一为 []interface{}
+// 类型的转换规则与 Unmarshal 相同
+type treeConfig struct {
+	data interface{}
+	// 生成该配置所读取的文件
+	files []string
+	// 叶子节点的来源, 只有分层读取的配置才会记录
+	sources map[string]string
+}
+
+func newTreeConfig(data interface{}, files ...string) *treeConfig {
+	return &treeConfig{
+		data:  data,
+		files: files,
+	}
+}
+
+// 生成该配置所读取的文件, 包括include的文件与runmode对应的覆盖文件
+func (config *treeConfig) Files() []string {
+	return config.files
+}
+
+// key的来源, 如 `file config.yaml`, 列表中的元素返回列表的来源
+func (config *treeConfig) source(key string) string {
+	for {
+		if source, ok := config.sources[key]; ok {
+			return source
+		}
+		index := strings.LastIndex(key, "::")
+		if index < 0 {
+			return ""
+		}
+		key = key[:index]
+	}
+}
+
+// 按 `a::b::c` 的路径查找节点, key为空时返回整个配置
+func (config *treeConfig) Value(key string) (interface{}, error) {
+	node := config.data
+	if key == "" {
+		return node, nil
+	}
+	for _, name := range strings.Split(key, "::") {
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, notFound(key)
+		}
+		if node, ok = m[name]; !ok {
+			return nil, notFound(key)
+		}
+	}
+	if node == nil {
+		return nil, notFound(key)
+	}
+	return node, nil
+}
+
+// 顶层的key
+func (config *treeConfig) topKeys() []string {
+	m, _ := config.data.(map[string]interface{})
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// 查找key对应的节点并转换为out的类型
+func (config *treeConfig) decode(key string, out interface{}) error {
+	raw, err := config.Value(key)
+	if err != nil {
+		return err
+	}
+	return decodeKey(key, raw, out)
+}
+
+func (config *treeConfig) String(key string) (res string, err error) {
+	err = config.decode(key, &res)
+	return
+}
+
+func (config *treeConfig) Strings(key string) (res []string, err error) {
+	err = config.decode(key, &res)
+	return
+}
+
+func (config *treeConfig) Int(key string) (res int, err error) {
+	err = config.decode(key, &res)
+	return
+}
+
+func (config *treeConfig) Ints(key string) (res []int, err error) {
+	err = config.decode(key, &res)
+	return
+}
+
+func (config *treeConfig) Float(key string) (res float64, err error) {
+	err = config.decode(key, &res)
+	return
+}
+
+func (config *treeConfig) Floats(key string) (res []float64, err error) {
+	err = config.decode(key, &res)
+	return
+}
+
+func (config *treeConfig) Bool(key string) (res bool, err error) {
+	err = config.decode(key, &res)
+	return
+}
+
+func (config *treeConfig) Bools(key string) (res []bool, err error) {
+	err = config.decode(key, &res)
+	return
+}
+
+func (config *treeConfig) Duration(key string) (res time.Duration, err error) {
+	err = config.decode(key, &res)
+	return
+}
+
+func (config *treeConfig) Size(key string) (res ByteSize, err error) {
+	err = config.decode(key, &res)
+	return
+}
+
+func (config *treeConfig) Map(key string) (res map[string]interface{}, err error) {
+	err = config.decode(key, &res)
+	return
+}
+
+func (config *treeConfig) Maps(key string) (res []map[string]interface{}, err error) {
+	err = config.decode(key, &res)
+	return
+}
+
+func (config *treeConfig) Has(key string) bool {
+	return hasKey(config, key)
+}
+
+func (config *treeConfig) Keys(key string) ([]string, error) {
+	return mapKeys(config, key)
+}
+
+func (config *treeConfig) Sub(key string) Configer {
+	return newSubConfig(config, key)
+}
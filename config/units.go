@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 以字节为单位的大小, 配置中可以写成 `64MB` `512KB` `1G` 之类的形式
+type ByteSize int64
+
+const (
+	Byte     ByteSize = 1
+	KiloByte          = 1024 * Byte
+	MegaByte          = 1024 * KiloByte
+	GigaByte          = 1024 * MegaByte
+	TeraByte          = 1024 * GigaByte
+)
+
+var sizeUnits = map[string]ByteSize{
+	"":    Byte,
+	"b":   Byte,
+	"k":   KiloByte,
+	"kb":  KiloByte,
+	"kib": KiloByte,
+	"m":   MegaByte,
+	"mb":  MegaByte,
+	"mib": MegaByte,
+	"g":   GigaByte,
+	"gb":  GigaByte,
+	"gib": GigaByte,
+	"t":   TeraByte,
+	"tb":  TeraByte,
+	"tib": TeraByte,
+}
+
+// 解析 `64MB` 形式的大小, 单位按1024进制计算, 不带单位时表示字节数
+func ParseSize(s string) (ByteSize, error) {
+	s = strings.TrimSpace(s)
+	index := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if index < 0 {
+		index = len(s)
+	}
+	number, unit := s[:index], strings.ToLower(strings.TrimSpace(s[index:]))
+	multiple, ok := sizeUnits[unit]
+	if !ok || number == "" {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	f, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return ByteSize(f * float64(multiple)), nil
+}
+
+// 将配置中的原始值转换为时间间隔
+// 字符串按 time.ParseDuration 解析, 如 `240s` `5m`, 数字表示秒数
+// 不带单位的字符串(如环境变量中的 `240`)同样表示秒数
+func toDuration(raw interface{}) (time.Duration, bool) {
+	switch value := raw.(type) {
+	case string:
+		value = strings.TrimSpace(value)
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return time.Duration(f * float64(time.Second)), true
+		}
+		d, err := time.ParseDuration(value)
+		return d, err == nil
+	case int:
+		return time.Duration(value) * time.Second, true
+	case float64:
+		return time.Duration(value * float64(time.Second)), true
+	}
+	return 0, false
+}
+
+// 将配置中的原始值转换为字节大小, 数字表示字节数
+func toSize(raw interface{}) (ByteSize, bool) {
+	switch value := raw.(type) {
+	case string:
+		size, err := ParseSize(value)
+		return size, err == nil
+	case int:
+		return ByteSize(value), true
+	case float64:
+		return ByteSize(value), true
+	}
+	return 0, false
+}
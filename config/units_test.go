@@ -0,0 +1,61 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]ByteSize{
+		"512":    512,
+		"1KB":    KiloByte,
+		"64MB":   64 * MegaByte,
+		"1.5g":   GigaByte + 512*MegaByte,
+		"2 TiB":  2 * TeraByte,
+		" 10 b ": 10,
+	}
+	for s, expect := range cases {
+		size, err := ParseSize(s)
+		if err != nil || size != expect {
+			t.Errorf("ParseSize(%q) got %d %v, expect %d", s, size, err, expect)
+		}
+	}
+	for _, s := range []string{"", "MB", "12XB", "1.2.3K"} {
+		if _, err := ParseSize(s); err == nil {
+			t.Errorf("ParseSize(%q) should fail", s)
+		}
+	}
+}
+
+func TestYamlConfigFloatDurationSize(t *testing.T) {
+	config := newTestYamlConfig(t, `
+redis:
+    idle_timeout: 5m
+    weight: 0.75
+    ratio: 2
+    weights: [0.5, 1]
+    buffer: 64MB
+    timeout_seconds: 30
+`)
+	if f, err := config.Float("redis::weight"); err != nil || f != 0.75 {
+		t.Errorf("redis::weight got %v %v", f, err)
+	}
+	if f, err := config.Float("redis::ratio"); err != nil || f != 2 {
+		t.Errorf("redis::ratio got %v %v", f, err)
+	}
+	if fs, err := config.Floats("redis::weights"); err != nil || len(fs) != 2 || fs[1] != 1 {
+		t.Errorf("redis::weights got %v %v", fs, err)
+	}
+	if d, err := config.Duration("redis::idle_timeout"); err != nil || d != 5*time.Minute {
+		t.Errorf("redis::idle_timeout got %v %v", d, err)
+	}
+	if d, err := config.Duration("redis::timeout_seconds"); err != nil || d != 30*time.Second {
+		t.Errorf("redis::timeout_seconds got %v %v", d, err)
+	}
+	if size, err := config.Size("redis::buffer"); err != nil || size != 64*MegaByte {
+		t.Errorf("redis::buffer got %v %v", size, err)
+	}
+	if _, err := config.Duration("redis::weights"); err == nil {
+		t.Error("redis::weights should not be a duration")
+	}
+}
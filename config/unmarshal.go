@@ -0,0 +1,344 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// 将key对应的配置解析到结构体中
+//
+// 结构体的字段通过tag来描述, 如
+//
+//	type PoolConfig struct {
+//		Hosts   []string `config:"hosts,required"`
+//		MaxIdle int      `config:"max_idle" default:"10"`
+//	}
+//
+// `config` tag 的第一部分是配置中的名字, 为空时按大小写不敏感的方式匹配字段名,
+// `required` 表示该配置必须存在, `-` 表示忽略该字段
+// `default` tag 是配置不存在时使用的默认值, 以yaml的方式解析
+func Unmarshal(key string, v interface{}) error {
+	return UnmarshalConfiger(GlobalConfiger, key, v)
+}
+
+// 从指定的Configer中解析配置
+func UnmarshalConfiger(configer Configer, key string, v interface{}) error {
+	return unmarshalConfiger(configer, key, v, false)
+}
+
+// 与UnmarshalConfiger相同, 但配置中结构体没有对应字段的key也会作为错误返回,
+// 用于检查配置中拼写错误的key
+func StrictUnmarshalConfiger(configer Configer, key string, v interface{}) error {
+	return unmarshalConfiger(configer, key, v, true)
+}
+
+func unmarshalConfiger(configer Configer, key string, v interface{}, strict bool) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("config: unmarshal %s need a non-nil pointer, got %T", key, v)
+	}
+	raw, err := configer.Value(key)
+	if err != nil {
+		if !IsNotFound(err) {
+			return err
+		}
+		raw = nil
+	}
+	decoder := &decoder{strict: strict}
+	decoder.decode(key, raw, rv.Elem())
+	if len(decoder.errs) > 0 {
+		return decoder.errs
+	}
+	return nil
+}
+
+// 将原始值转换为v的类型, v需要是一个指针
+func decodeValue(key string, raw interface{}, v interface{}) error {
+	decoder := &decoder{}
+	decoder.decode(key, raw, reflect.ValueOf(v).Elem())
+	if len(decoder.errs) > 0 {
+		return decoder.errs
+	}
+	return nil
+}
+
+// 解析配置时的错误, 包含了完整的key
+type UnmarshalError struct {
+	Key    string
+	Reason string
+}
+
+func (e *UnmarshalError) Error() string {
+	return fmt.Sprintf("config %s: %s", e.Key, e.Reason)
+}
+
+// 解析配置时的所有错误
+type UnmarshalErrors []*UnmarshalError
+
+func (errs UnmarshalErrors) Error() string {
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	byteSizeType = reflect.TypeOf(ByteSize(0))
+)
+
+type decoder struct {
+	errs UnmarshalErrors
+	// 是否将结构体中没有的key作为错误
+	strict bool
+}
+
+func (d *decoder) fail(key string, format string, args ...interface{}) {
+	d.errs = append(d.errs, &UnmarshalError{
+		Key:    key,
+		Reason: fmt.Sprintf(format, args...),
+	})
+}
+
+func (d *decoder) decode(key string, raw interface{}, out reflect.Value) {
+	if raw == nil {
+		// 没有配置时也需要处理结构体的默认值与必填项
+		if out.Kind() == reflect.Struct {
+			d.decodeStruct(key, map[string]interface{}{}, out)
+		}
+		return
+	}
+
+	switch out.Type() {
+	case durationType:
+		duration, ok := toDuration(raw)
+		if !ok {
+			d.fail(key, "expect a duration, got %v", raw)
+			return
+		}
+		out.SetInt(int64(duration))
+		return
+	case byteSizeType:
+		size, ok := toSize(raw)
+		if !ok {
+			d.fail(key, "expect a size, got %v", raw)
+			return
+		}
+		out.SetInt(int64(size))
+		return
+	}
+
+	switch out.Kind() {
+	case reflect.Ptr:
+		if out.IsNil() {
+			out.Set(reflect.New(out.Type().Elem()))
+		}
+		d.decode(key, raw, out.Elem())
+	case reflect.Interface:
+		out.Set(reflect.ValueOf(raw))
+	case reflect.Struct:
+		m, ok := raw.(map[string]interface{})
+		if !ok {
+			d.fail(key, "expect a map, got %T", raw)
+			return
+		}
+		d.decodeStruct(key, m, out)
+	case reflect.Map:
+		d.decodeMap(key, raw, out)
+	case reflect.Slice:
+		d.decodeSlice(key, raw, out)
+	case reflect.String:
+		switch value := raw.(type) {
+		case string:
+			out.SetString(value)
+		case int, float64, bool:
+			out.SetString(fmt.Sprint(value))
+		default:
+			d.fail(key, "expect a string, got %T", raw)
+		}
+	case reflect.Bool:
+		switch value := raw.(type) {
+		case bool:
+			out.SetBool(value)
+		case string:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				d.fail(key, "expect a bool, got %q", value)
+				return
+			}
+			out.SetBool(b)
+		default:
+			d.fail(key, "expect a bool, got %T", raw)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := toInt64(raw)
+		if !ok || out.OverflowInt(i) {
+			d.fail(key, "expect an int, got %v", raw)
+			return
+		}
+		out.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, ok := toInt64(raw)
+		if !ok || i < 0 || out.OverflowUint(uint64(i)) {
+			d.fail(key, "expect an unsigned int, got %v", raw)
+			return
+		}
+		out.SetUint(uint64(i))
+	case reflect.Float32, reflect.Float64:
+		f, ok := toFloat64(raw)
+		if !ok {
+			d.fail(key, "expect a float, got %v", raw)
+			return
+		}
+		out.SetFloat(f)
+	default:
+		d.fail(key, "unsupported type %s", out.Type())
+	}
+}
+
+func (d *decoder) decodeStruct(key string, m map[string]interface{}, out reflect.Value) {
+	outType := out.Type()
+	// 已经被字段使用的key
+	used := make(map[string]bool, len(m))
+	for i := 0; i < outType.NumField(); i++ {
+		field := outType.Field(i)
+		// 未导出的字段
+		if field.PkgPath != "" {
+			continue
+		}
+		name, required := parseConfigTag(field)
+		if name == "-" {
+			continue
+		}
+
+		fieldKey := key + "::" + name
+		raw, ok := m[name]
+		if ok {
+			used[name] = true
+		} else {
+			for k, v := range m {
+				if strings.EqualFold(k, name) {
+					fieldKey = key + "::" + k
+					raw, ok = v, true
+					used[k] = true
+					break
+				}
+			}
+		}
+
+		if !ok || raw == nil {
+			if def, hasDefault := field.Tag.Lookup("default"); hasDefault {
+				var value interface{}
+				if err := yaml.Unmarshal([]byte(def), &value); err != nil {
+					d.fail(fieldKey, "bad default value %q: %s", def, err)
+					continue
+				}
+				raw = convertYamlValue(value)
+			} else if required {
+				d.fail(fieldKey, "is required")
+				continue
+			}
+		}
+		d.decode(fieldKey, raw, out.Field(i))
+	}
+
+	if d.strict {
+		unknown := make([]string, 0)
+		for k := range m {
+			if !used[k] {
+				unknown = append(unknown, k)
+			}
+		}
+		sort.Strings(unknown)
+		for _, k := range unknown {
+			d.fail(key+"::"+k, "unknown key")
+		}
+	}
+}
+
+func (d *decoder) decodeMap(key string, raw interface{}, out reflect.Value) {
+	m, ok := raw.(map[string]interface{})
+	if !ok {
+		d.fail(key, "expect a map, got %T", raw)
+		return
+	}
+	if out.Type().Key().Kind() != reflect.String {
+		d.fail(key, "unsupported map key type %s", out.Type().Key())
+		return
+	}
+	if out.IsNil() {
+		out.Set(reflect.MakeMap(out.Type()))
+	}
+	for k, v := range m {
+		elem := reflect.New(out.Type().Elem()).Elem()
+		d.decode(key+"::"+k, v, elem)
+		out.SetMapIndex(reflect.ValueOf(k).Convert(out.Type().Key()), elem)
+	}
+}
+
+func (d *decoder) decodeSlice(key string, raw interface{}, out reflect.Value) {
+	items, ok := raw.([]interface{})
+	if !ok {
+		d.fail(key, "expect a list, got %T", raw)
+		return
+	}
+	slice := reflect.MakeSlice(out.Type(), len(items), len(items))
+	for i, item := range items {
+		d.decode(fmt.Sprintf("%s::%d", key, i), item, slice.Index(i))
+	}
+	out.Set(slice)
+}
+
+func parseConfigTag(field reflect.StructField) (name string, required bool) {
+	parts := strings.Split(field.Tag.Get("config"), ",")
+	name = parts[0]
+	for _, option := range parts[1:] {
+		if option == "required" {
+			required = true
+		}
+	}
+	if name == "" {
+		name = field.Name
+	}
+	return
+}
+
+func toInt64(raw interface{}) (int64, bool) {
+	switch value := raw.(type) {
+	case int:
+		return int64(value), true
+	case int64:
+		return value, true
+	case float64:
+		if value != float64(int64(value)) {
+			return 0, false
+		}
+		return int64(value), true
+	case string:
+		i, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+func toFloat64(raw interface{}) (float64, bool) {
+	switch value := raw.(type) {
+	case int:
+		return float64(value), true
+	case int64:
+		return float64(value), true
+	case float64:
+		return value, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+type testPoolConfig struct {
+	Hosts     []string `config:"hosts,required"`
+	Framed    bool     `config:"framed"`
+	MaxIdle   int      `config:"max_idle" default:"10"`
+	MaxRetry  uint     `config:"max_retry" default:"2"`
+	MaxActive int
+}
+
+func TestUnmarshal(t *testing.T) {
+	config := newTestYamlConfig(t, testYaml+"        max_retry: 3\n")
+
+	poolConfig := &testPoolConfig{}
+	if err := UnmarshalConfiger(config, "thriftpool::upserver", poolConfig); err != nil {
+		t.Fatal(err)
+	}
+	if len(poolConfig.Hosts) != 1 || poolConfig.Hosts[0] != "10.0.0.206:3091" {
+		t.Errorf("hosts got %v", poolConfig.Hosts)
+	}
+	if poolConfig.MaxIdle != 10 || poolConfig.MaxRetry != 3 {
+		t.Errorf("got %+v", poolConfig)
+	}
+
+	var dbConfigs map[string]*struct {
+		Dsn     string `config:"dsn,required"`
+		MaxIdle int
+	}
+	if err := UnmarshalConfiger(config, "mysql", &dbConfigs); err != nil {
+		t.Fatal(err)
+	}
+	if dbConfigs["default"].MaxIdle != 5 {
+		t.Errorf("mysql::default got %+v", dbConfigs["default"])
+	}
+}
+
+func TestUnmarshalError(t *testing.T) {
+	config := newTestYamlConfig(t, testYaml)
+
+	err := UnmarshalConfiger(config, "thriftpool::downserver", &testPoolConfig{})
+	if err == nil || err.Error() != "config thriftpool::downserver::hosts: is required" {
+		t.Errorf("got %v", err)
+	}
+
+	var serverConfig struct {
+		Port int    `config:"servermode"`
+		Mode string `config:"serverport"`
+		Host []string
+	}
+	err = UnmarshalConfiger(config, "server", &serverConfig)
+	errs, ok := err.(UnmarshalErrors)
+	if !ok || len(errs) != 1 || !strings.Contains(err.Error(), "server::servermode") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestStrictUnmarshal(t *testing.T) {
+	config := newTestYamlConfig(t, testYaml+"        maxIdle: 3\n        fraxmed: true\n")
+
+	if err := UnmarshalConfiger(config, "thriftpool::upserver", &testPoolConfig{}); err != nil {
+		t.Errorf("not strict got %v", err)
+	}
+
+	err := StrictUnmarshalConfiger(config, "thriftpool::upserver", &testPoolConfig{})
+	errs, ok := err.(UnmarshalErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("got %v", err)
+	}
+	if errs[0].Key != "thriftpool::upserver::fraxmed" || errs[1].Key != "thriftpool::upserver::maxIdle" {
+		t.Errorf("got %v", err)
+	}
+}
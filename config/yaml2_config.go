@@ -1,140 +1,65 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
-	"strings"
 
-	"github.com/smallfish/simpleyaml"
+	"gopkg.in/yaml.v2"
 )
 
-
 // yaml的配置文件的一种实现
 type YamlConfig struct {
-	*simpleyaml.Yaml
+	*treeConfig
 }
 
 func NewYamlConfig(filename string) Configer {
-	content, err := ioutil.ReadFile(filename)
-	if err != nil {
-		panic(err)
-	}
-	yaml, err := simpleyaml.NewYaml(content)
+	yamlConfig, err := LoadYamlConfig(filename)
 	if err != nil {
 		panic(err)
 	}
-	yamlConfig := &YamlConfig{
-		Yaml: yaml,
-	}
 	return yamlConfig
 }
 
-func (config *YamlConfig) getNode(nodeName string) *simpleyaml.Yaml {
-	nodes := strings.Split(nodeName, "::")
-	interfaces := make([]interface{}, 0, len(nodes))
-	for _, node := range nodes {
-		interfaces = append(interfaces, node)
-	}
-	return config.GetPath(interfaces...)
-}
-
-func (config *YamlConfig) String(nodeName string) (string, error) {
-	node := config.getNode(nodeName)
-	res, err := node.String()
-	if err != nil {
-		return "", err
-	}
-	return res, nil
-}
-
-func (config *YamlConfig) Strings(nodeName string) ([]string, error) {
-	node := config.getNode(nodeName)
-	res, err := node.Array()
+// 读取yaml配置文件, 与NewYamlConfig不同的是出错时返回error而不是panic
+func LoadYamlConfig(filename string) (*YamlConfig, error) {
+	content, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return nil, err
 	}
-	result := make([]string, 0, len(res))
-	for _, item := range res {
-		result = append(result, item.(string))
-	}
-	return result, nil
-}
-
-func (config *YamlConfig) Int(nodeName string) (int, error) {
-	node := config.getNode(nodeName)
-	return node.Int()
-}
-
-func (config *YamlConfig) Ints(nodeName string) ([]int, error) {
-	node := config.getNode(nodeName)
-	res, err := node.Array()
+	data, err := parseYaml(content)
 	if err != nil {
 		return nil, err
 	}
-
-	result := make([]int, 0, len(res))
-	for _, item := range res {
-		result = append(result, item.(int))
-	}
-	return result, nil
-}
-
-func (config *YamlConfig) Float(nodeName string) (float64, error) {
-	return 0, nil
-}
-
-func (config *YamlConfig) Floats(nodeName string) (result []float64, err error) {
-	return
-}
-
-func (config *YamlConfig) Bool(nodeName string) (bool, error) {
-	return config.getNode(nodeName).Bool()
-}
-
-func (config *YamlConfig) Bools(nodeName string) ([]bool, error) {
-	node := config.getNode(nodeName)
-	res, err := node.Array()
-	if err != nil {
-		return nil, err
-	}
-
-	result := make([]bool, 0, len(res))
-	for _, item := range res {
-		result = append(result, item.(bool))
+	yamlConfig := &YamlConfig{
+		treeConfig: newTreeConfig(data, filename),
 	}
-	return result, nil
+	return yamlConfig, nil
 }
 
-func (config *YamlConfig) Map(nodeName string) (map[string]interface{}, error) {
-	res, err := config.getNode(nodeName).Map()
-	if err != nil {
+func parseYaml(content []byte) (interface{}, error) {
+	var data interface{}
+	if err := yaml.Unmarshal(content, &data); err != nil {
 		return nil, err
 	}
-	return mapConvert(res), nil
+	return convertYamlValue(data), nil
 }
 
-
-
-func (config *YamlConfig) Maps(nodeName string) ([]map[string]interface{}, error) {
-	res, err := config.getNode(nodeName).Array()
-	if err != nil {
-		return nil, err
-	}
-	result := make([]map[string]interface{}, 0, len(res))
-	for _, item := range res {
-		result = append(result, mapConvert(
-			item.(map[interface{}]interface{})))
-	}
-	return result, nil
-}
-
-func mapConvert(in map[interface{}]interface{}) map[string]interface{} {
-	out := make(map[string]interface{}, len(in))
-	for key, value := range in {
-		if mapValue, ok := value.(map[interface{}]interface{}); ok {
-			out[key.(string)] = mapConvert(mapValue)
-		} else {
-			out[key.(string)] = value
+// 将yaml解析出的值中的 map[interface{}]interface{} 递归转换为 map[string]interface{}
+func convertYamlValue(in interface{}) interface{} {
+	switch value := in.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			out[fmt.Sprint(k)] = convertYamlValue(v)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, 0, len(value))
+		for _, v := range value {
+			out = append(out, convertYamlValue(v))
 		}
+		return out
+	default:
+		return value
 	}
-	return out
 }
@@ -0,0 +1,168 @@
+package monica
+
+import (
+	"fmt"
+
+	"github.com/DrWrong/monica/config"
+	"github.com/DrWrong/monica/logger"
+	"github.com/DrWrong/monica/webserver"
+)
+
+// 框架读取的配置 以及检查的方法
+var configSections = []struct {
+	name  string
+	check func(configer config.Configer, strict bool) []error
+}{
+	{"server", checkServerConfig},
+	{"mysql", checkDbConfig},
+	{"redis", checkRedisConfig},
+	{"thriftpool", checkThriftPoolConfig},
+	{"log", checkLogConfig},
+	{"dm303", checkDm303Config},
+	{"daemon", checkDaemonConfig},
+	{"supervise", checkSuperviseConfig},
+}
+
+// 检查配置中框架读取的部分, 返回所有的错误
+// 配置中不存在的部分不做检查, strict 时结构体中没有对应字段的key (通常是拼写错误) 也作为错误
+func checkConfig(configer config.Configer, strict bool) []error {
+	errs := make([]error, 0)
+	for _, section := range configSections {
+		if _, err := configer.Value(section.name); err != nil {
+			if !config.IsNotFound(err) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		errs = append(errs, section.check(configer, strict)...)
+	}
+	return errs
+}
+
+// 解析配置, UnmarshalErrors 会被展开为多个错误
+func checkUnmarshal(configer config.Configer, key string, v interface{}, strict bool) []error {
+	var err error
+	if strict {
+		err = config.StrictUnmarshalConfiger(configer, key, v)
+	} else {
+		err = config.UnmarshalConfiger(configer, key, v)
+	}
+	if err == nil {
+		return nil
+	}
+	unmarshalErrs, ok := err.(config.UnmarshalErrors)
+	if !ok {
+		return []error{err}
+	}
+	errs := make([]error, 0, len(unmarshalErrs))
+	for _, e := range unmarshalErrs {
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+// 检查 servermode, redirect 只能用在 listeners 中
+func checkServerMode(key, mode string, allowRedirect bool) []error {
+	switch mode {
+	case "http", "https", "fastcgi":
+		return nil
+	case "redirect":
+		if allowRedirect {
+			return nil
+		}
+	}
+	return []error{fmt.Errorf("config %s: not support server mode %q", key, mode)}
+}
+
+func checkServerConfig(configer config.Configer, strict bool) []error {
+	serverConfig := &webserver.ServerConfig{}
+	errs := checkUnmarshal(configer, "server", serverConfig, strict)
+	if len(serverConfig.Listeners) == 0 && serverConfig.Port == 0 && serverConfig.Listen == "" {
+		errs = append(errs, fmt.Errorf("config server: serverport, listen or listeners is required"))
+	}
+	if _, err := serverConfig.SocketFileMode(); err != nil {
+		errs = append(errs, fmt.Errorf("config server::socket_mode: %s", err))
+	}
+	if len(serverConfig.Listeners) == 0 {
+		errs = append(errs, checkServerMode("server::servermode", serverConfig.ServerMode, false)...)
+	}
+	for i, listener := range serverConfig.Listeners {
+		errs = append(errs, checkServerMode(fmt.Sprintf("server::listeners::%d::servermode", i), listener.ServerMode, true)...)
+	}
+	if serverConfig.HasMode("https") {
+		if serverConfig.CertFile == "" || serverConfig.KeyFile == "" {
+			errs = append(errs, fmt.Errorf("config server: cert_file and key_file are required in https mode"))
+		}
+		if _, err := webserver.ParseTLSVersion(serverConfig.TLSMinVersion); err != nil {
+			errs = append(errs, fmt.Errorf("config server::tls_min_version: %s", err))
+		}
+	}
+	return errs
+}
+
+func checkDbConfig(configer config.Configer, strict bool) []error {
+	var dbConfigs map[string]*DbConfig
+	errs := checkUnmarshal(configer, "mysql", &dbConfigs, strict)
+	if _, ok := dbConfigs["default"]; !ok {
+		errs = append(errs, fmt.Errorf("config mysql: a database instance called default must be configured"))
+	}
+	return errs
+}
+
+func checkRedisConfig(configer config.Configer, strict bool) []error {
+	return checkUnmarshal(configer, "redis", &RedisConfig{}, strict)
+}
+
+func checkThriftPoolConfig(configer config.Configer, strict bool) []error {
+	var poolConfigs map[string]*ThriftPoolConfig
+	return checkUnmarshal(configer, "thriftpool", &poolConfigs, strict)
+}
+
+func checkLogConfig(configer config.Configer, strict bool) []error {
+	logConfig := &LogConfig{}
+	errs := checkUnmarshal(configer, "log", logConfig, strict)
+
+	handlers := make(map[string]bool, len(logConfig.Handlers))
+	for i, handler := range logConfig.Handlers {
+		if handler == nil {
+			continue
+		}
+		handlers[handler.Name] = true
+		if !logger.HandlerTypeRegistered(handler.Type) {
+			errs = append(errs, fmt.Errorf("config log::handlers::%d::type: not support handler type %q",
+				i, handler.Type))
+		}
+	}
+	for i, loggerConfig := range logConfig.Loggers {
+		if loggerConfig == nil {
+			continue
+		}
+		if _, err := logger.ParseLevel(loggerConfig.Level); err != nil {
+			errs = append(errs, fmt.Errorf("config log::loggers::%d::level: %s", i, err))
+		}
+		for _, name := range loggerConfig.Handlers {
+			if !handlers[name] {
+				errs = append(errs, fmt.Errorf("config log::loggers::%d::handlers: handler %s not exist",
+					i, name))
+			}
+		}
+	}
+	return errs
+}
+
+func checkDm303Config(configer config.Configer, strict bool) []error {
+	return checkUnmarshal(configer, "dm303", &Dm303Config{}, strict)
+}
+
+func checkDaemonConfig(configer config.Configer, strict bool) []error {
+	daemonConfig := &DaemonConfig{}
+	errs := checkUnmarshal(configer, "daemon", daemonConfig, strict)
+	if _, err := daemonConfig.umask(); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+func checkSuperviseConfig(configer config.Configer, strict bool) []error {
+	return checkUnmarshal(configer, "supervise", &SuperviseConfig{}, strict)
+}
@@ -0,0 +1,174 @@
+package monica
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/DrWrong/monica/config"
+	"gopkg.in/urfave/cli.v2"
+)
+
+// config 子命令 用于管理配置文件
+func newConfigCommand() *cli.Command {
+	keyFileFlag := &cli.StringFlag{
+		Name:  "key-file",
+		Usage: "file contains the secret key, default read from env " + config.SecretKeyEnv + " or " + config.SecretKeyFileEnv,
+	}
+	return &cli.Command{
+		Name:  "config",
+		Usage: "manage the config file",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "check",
+				Usage:     "check the sections used by monica and list all the errors",
+				ArgsUsage: "[config file]",
+				Action:    exitAfter(checkConfigAction),
+			},
+			{
+				Name:      "dump",
+				Usage:     "print the effective config with the source of each value, secrets are masked",
+				ArgsUsage: "[config file]",
+				Action:    exitAfter(dumpConfigAction),
+			},
+			{
+				Name:   "genkey",
+				Usage:  "generate a secret key for encrypting config values",
+				Action: exitAfter(genSecretKeyAction),
+			},
+			{
+				Name:      "encrypt",
+				Usage:     "encrypt a config value, read from stdin if value is not given",
+				ArgsUsage: "[value]",
+				Flags:     []cli.Flag{keyFileFlag},
+				Action:    exitAfter(encryptValueAction),
+			},
+			{
+				Name:      "decrypt",
+				Usage:     "decrypt an enc:v1: config value, read from stdin if value is not given",
+				ArgsUsage: "[value]",
+				Flags:     []cli.Flag{keyFileFlag},
+				Action:    exitAfter(decryptValueAction),
+			},
+		},
+	}
+}
+
+// 子命令执行完之后直接退出, 不再执行 App.Run 之后启动服务的代码
+func exitAfter(action cli.ActionFunc) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		err := action(c)
+		if err == nil {
+			return cli.Exit("", 0)
+		}
+		if _, ok := err.(cli.ExitCoder); !ok {
+			return cli.Exit(err, 1)
+		}
+		return err
+	}
+}
+
+// 配置文件 默认与启动时的查找规则相同
+func configFileArg(c *cli.Context) (string, error) {
+	if c.Args().Present() {
+		return c.Args().First(), nil
+	}
+	if configPath := getConfigerFile(c); configPath != "" {
+		return configPath, nil
+	}
+	return "", fmt.Errorf("config file not found")
+}
+
+func checkConfigAction(c *cli.Context) error {
+	configPath, err := configFileArg(c)
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	configer, err := config.LoadConfiger(configPath)
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	errs := checkConfig(configer, true)
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if len(errs) > 0 {
+		return cli.Exit(fmt.Sprintf("%s: %d error(s)", configPath, len(errs)), 1)
+	}
+	fmt.Fprintf(c.App.Writer, "%s: ok\n", configPath)
+	return nil
+}
+
+func dumpConfigAction(c *cli.Context) error {
+	configPath, err := configFileArg(c)
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	entries, err := config.DumpConfigFile(configPath)
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	writer := tabwriter.NewWriter(c.App.Writer, 0, 4, 2, ' ', 0)
+	for _, entry := range entries {
+		fmt.Fprintf(writer, "%s\t%s\t# %s\n", entry.Key, entry.Value, entry.Source)
+	}
+	return writer.Flush()
+}
+
+func genSecretKeyAction(c *cli.Context) error {
+	key, err := config.GenerateSecretKey()
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	fmt.Fprintln(c.App.Writer, config.EncodeSecretKey(key))
+	return nil
+}
+
+func encryptValueAction(c *cli.Context) error {
+	key, err := loadSecretKey(c)
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	encrypted, err := config.EncryptValue(key, readValueArg(c))
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	fmt.Fprintln(c.App.Writer, encrypted)
+	return nil
+}
+
+func decryptValueAction(c *cli.Context) error {
+	key, err := loadSecretKey(c)
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	plain, err := config.DecryptValue(key, readValueArg(c))
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	fmt.Fprintln(c.App.Writer, plain)
+	return nil
+}
+
+func loadSecretKey(c *cli.Context) ([]byte, error) {
+	if keyFile := c.String("key-file"); keyFile != "" {
+		content, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return config.DecodeSecretKey(string(content))
+	}
+	return config.LoadSecretKey()
+}
+
+// 从参数中读取值, 没有参数时从标准输入读取一行, 以免明文留在shell的历史中
+func readValueArg(c *cli.Context) string {
+	if c.Args().Present() {
+		return c.Args().First()
+	}
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimRight(line, "\r\n")
+}
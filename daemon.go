@@ -0,0 +1,345 @@
+package monica
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/DrWrong/monica/config"
+)
+
+// 重启时传递给子进程的已经锁住的pid文件的文件描述符
+const MONICA_PIDFILE_FD = "MONICA_PIDFILE_FD"
+
+// 进程的启动时间
+var startTime = time.Now()
+
+// 运行中的进程的信息, 与pid文件一起写入 <pidfile>.info, 用于 status 子命令
+type processInfo struct {
+	Pid       int       `json:"pid"`
+	Version   string    `json:"version"`
+	StartTime time.Time `json:"start_time"`
+	// 是否是 supervise 模式的master
+	Master bool `json:"master,omitempty"`
+}
+
+// 后台运行的配置 对应配置文件中的 `daemon` 部分
+type DaemonConfig struct {
+	// 工作目录, 默认为启动时的目录
+	WorkDir string `config:"workdir"`
+	// 八进制的文件权限掩码, yaml中需要加引号, 如 "022"
+	Umask string `config:"umask" default:"'022'"`
+	// 标准输出与标准错误重定向的文件, 默认为 logs/<name>.out
+	Stdout string `config:"stdout"`
+	Stderr string `config:"stderr"`
+}
+
+func (daemonConfig *DaemonConfig) umask() (int, error) {
+	umask, err := strconv.ParseUint(daemonConfig.Umask, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("config daemon::umask: invalid umask %q", daemonConfig.Umask)
+	}
+	return int(umask), nil
+}
+
+func (app *MonicaApp) daemonConfig() (*DaemonConfig, error) {
+	configer := config.GlobalConfiger
+	if !app.globalConfigInited {
+		configer = config.NewMapConfig(nil)
+	}
+	daemonConfig := &DaemonConfig{}
+	if err := config.UnmarshalConfiger(configer, "daemon", daemonConfig); err != nil {
+		return nil, err
+	}
+	if daemonConfig.Stdout == "" {
+		daemonConfig.Stdout = path.Join("logs", fmt.Sprintf("%s.out", app.name))
+	}
+	if daemonConfig.Stderr == "" {
+		daemonConfig.Stderr = daemonConfig.Stdout
+	}
+	return daemonConfig, nil
+}
+
+// 运行目录, 相对路径的pid文件与输出文件都相对于运行目录
+func runDir() string {
+	runDir := os.Getenv("MONICA_RUNDIR")
+	if runDir == "" {
+		runDir, _ = os.Getwd()
+	}
+	return runDir
+}
+
+func (app *MonicaApp) getPidFile() string {
+	if app.globalConfigInited {
+		pidFile, _ := config.String("pidfile")
+		if pidFile != "" {
+			// 绝对路径
+			if strings.HasPrefix(pidFile, "/") {
+				return pidFile
+			}
+			return path.Join(os.Getenv("MONICA_RUNDIR"), pidFile)
+		}
+	}
+	return path.Join(runDir(), "logs", fmt.Sprintf("%s.pid", app.name))
+}
+
+func (app *MonicaApp) getProcess() *os.Process {
+	pidFile := app.getPidFile()
+	rawPid, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		return nil
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(rawPid)))
+	if err != nil {
+		return nil
+	}
+
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return nil
+	}
+	return p
+}
+
+// pid文件中的进程是否还在运行, pid被其他程序复用时也认为进程已经退出
+func (app *MonicaApp) processAlive(p *os.Process) bool {
+	if p == nil {
+		p = app.getProcess()
+	}
+
+	if p == nil {
+		return false
+	}
+	if err := p.Signal(syscall.Signal(0)); err != nil {
+		return false
+	}
+	return isSameBinary(p.Pid)
+}
+
+// pid对应的进程是否运行的是本程序, 没有 /proc 时无法判断, 认为是
+// 部署之后旧的进程的可执行文件已经被删除, 所以只比较文件名
+func isSameBinary(pid int) bool {
+	exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		_, statErr := os.Stat("/proc/self/exe")
+		return statErr != nil
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return true
+	}
+	return filepath.Base(strings.TrimSuffix(exe, " (deleted)")) == filepath.Base(self)
+}
+
+// pid文件是否被其他进程锁住
+func (app *MonicaApp) pidFileLocked() bool {
+	f, err := os.Open(app.getPidFile())
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		return err == syscall.EWOULDBLOCK
+	}
+	syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	return false
+}
+
+// 写入pid文件并持有文件锁直到进程退出, 两个进程同时启动时只有一个能拿到锁
+// 重启时直接使用父进程传递过来的已经锁住的pid文件
+func (app *MonicaApp) writePidFile() {
+	var f *os.File
+	if fd := os.Getenv(MONICA_PIDFILE_FD); fd != "" {
+		os.Unsetenv(MONICA_PIDFILE_FD)
+		if n, err := strconv.Atoi(fd); err == nil {
+			f = os.NewFile(uintptr(n), app.getPidFile())
+		}
+	}
+	if f == nil {
+		pidFile := app.getPidFile()
+		var err error
+		f, err = os.OpenFile(pidFile, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			panic(err)
+		}
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			log.Fatalln("FATAL: pid file", pidFile, "is locked, process is already running")
+		}
+	}
+	if err := f.Truncate(0); err != nil {
+		panic(err)
+	}
+	if _, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0); err != nil {
+		panic(err)
+	}
+	// 文件保持打开, 进程退出时锁自动释放
+	app.pidFile = f
+
+	info, _ := json.Marshal(&processInfo{
+		Pid:       os.Getpid(),
+		Version:   app.Version,
+		StartTime: startTime,
+		Master:    app.supervise,
+	})
+	if err := ioutil.WriteFile(app.getInfoFile(), info, 0644); err != nil {
+		log.Println("WARNING: write process info error", err)
+	}
+}
+
+func (app *MonicaApp) getInfoFile() string {
+	return app.getPidFile() + ".info"
+}
+
+// pid文件对应的进程的信息, 与pid文件不一致时返回nil
+func (app *MonicaApp) getProcessInfo(pid int) *processInfo {
+	content, err := ioutil.ReadFile(app.getInfoFile())
+	if err != nil {
+		return nil
+	}
+	info := &processInfo{}
+	if err := json.Unmarshal(content, info); err != nil || info.Pid != pid {
+		return nil
+	}
+	return info
+}
+
+func (app *MonicaApp) removePidFile() {
+	os.Remove(app.getPidFile())
+	os.Remove(app.getInfoFile())
+}
+
+func (app *MonicaApp) runInDaemonMode() {
+	// is children then we do nothing
+	if os.Getenv(MONICA_PROCESS_CHILDREN_FLAG) != "" {
+		return
+	}
+
+	// first we should check if any file already running
+	if app.pidFileLocked() || app.processAlive(nil) {
+		log.Fatalln("process is alive we will not start again...")
+	}
+	if p := app.getProcess(); p != nil {
+		log.Println("INFO: remove stale pid file of", p.Pid)
+		app.removePidFile()
+	}
+
+	daemonConfig, err := app.daemonConfig()
+	if err != nil {
+		log.Fatalln("FATAL:", err)
+	}
+	umask, err := daemonConfig.umask()
+	if err != nil {
+		log.Fatalln("FATAL:", err)
+	}
+	files, err := daemonFiles(daemonConfig)
+	if err != nil {
+		log.Fatalln("FATAL:", err)
+	}
+	workDir := daemonConfig.WorkDir
+	if workDir == "" {
+		workDir, _ = os.Getwd()
+	}
+	// 子进程使用相同的运行目录, 与启动时的相对路径一致
+	env := []string{}
+	if os.Getenv("MONICA_RUNDIR") == "" {
+		env = append(env, fmt.Sprintf("MONICA_RUNDIR=%s", runDir()))
+	}
+
+	// spawn children process
+	log.Println("INFO: starting process as daemon, output is redirected to", daemonConfig.Stdout)
+	// umask 会被子进程继承
+	oldUmask := syscall.Umask(umask)
+	p, err := app.startChild(files, workDir, env, nil)
+	syscall.Umask(oldUmask)
+	for _, f := range files {
+		f.Close()
+	}
+	if err != nil {
+		log.Println("FATAL: create new process error", err)
+		os.Exit(1)
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		p.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+		log.Println("FATAL: process exited, see", daemonConfig.Stderr)
+		os.Exit(1)
+	case <-time.After(time.Second):
+	}
+	log.Println("INFO: process is started at", p.Pid)
+	os.Exit(0)
+}
+
+// 后台进程的标准输入, 标准输出与标准错误
+func daemonFiles(daemonConfig *DaemonConfig) ([]*os.File, error) {
+	stdin, err := os.Open(os.DevNull)
+	if err != nil {
+		return nil, err
+	}
+	files := []*os.File{stdin}
+	for _, name := range []string{daemonConfig.Stdout, daemonConfig.Stderr} {
+		if !strings.HasPrefix(name, "/") {
+			name = path.Join(runDir(), name)
+		}
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// 用相同的参数启动子进程, files 依次为子进程的文件描述符0, 1, 2...
+// dir 为子进程的工作目录, 为空时与当前进程相同, env 为额外的环境变量
+// sys 为nil时子进程在新的会话中运行
+func (app *MonicaApp) startChild(files []*os.File, dir string, env []string, sys *syscall.SysProcAttr) (*os.Process, error) {
+	// 重新查找可执行文件, 部署后会启动新的版本
+	// 后台运行时工作目录可能已经改变, 相对路径相对于运行目录
+	binary := os.Args[0]
+	if !strings.Contains(binary, "/") {
+		var err error
+		if binary, err = exec.LookPath(binary); err != nil {
+			return nil, err
+		}
+	}
+	if !path.IsAbs(binary) {
+		binary = path.Join(runDir(), binary)
+	}
+	childEnv := make([]string, 0, len(os.Environ())+len(env)+1)
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, MONICA_LISTENERS+"=") || strings.HasPrefix(kv, MONICA_READY_FD+"=") ||
+			strings.HasPrefix(kv, MONICA_PIDFILE_FD+"=") {
+			continue
+		}
+		childEnv = append(childEnv, kv)
+	}
+	childEnv = append(childEnv, fmt.Sprintf("%s=true", MONICA_PROCESS_CHILDREN_FLAG))
+	childEnv = append(childEnv, env...)
+	if sys == nil {
+		sys = &syscall.SysProcAttr{Setsid: true}
+	}
+	return os.StartProcess(binary, os.Args, &os.ProcAttr{
+		Dir:   dir,
+		Env:   childEnv,
+		Files: files,
+		Sys:   sys,
+	})
+}
@@ -1,6 +1,7 @@
 package monica
 
 import (
+	"context"
 	"time"
 
 	"github.com/DrWrong/monica/config"
@@ -15,30 +16,46 @@ var (
 	RedisPool *redis.Pool
 )
 
+// the config of a database instance, read from `mysql::<name>`
+type DbConfig struct {
+	Dsn     string `config:"dsn,required"`
+	MaxIdle int    `config:"maxIdle"`
+	MaxOpen int    `config:"maxOpen"`
+}
+
+// the config of redis, read from `redis`
+type RedisConfig struct {
+	Address     string        `config:"address,required"`
+	Db          int           `config:"db"`
+	MaxIdle     int           `config:"max_idle" default:"5"`
+	IdleTimeout time.Duration `config:"idle_timeout" default:"240s"`
+}
+
 // init beego `orm` config
 // monica use beego's orm defaultly
 // however we set the `DefaultRowsLimit` to -1 here
 // the function read config from `default::mysql` part of yaml file
 func InitDb() {
-	configerMap, _ := config.Map("mysql")
-	if configerMap == nil {
+	if !config.Has("mysql") {
 		return
 	}
+	var dbConfigs map[string]*DbConfig
+	if err := config.Unmarshal("mysql", &dbConfigs); err != nil {
+		panic(err)
+	}
 
 	orm.DefaultRowsLimit = -1
 	orm.RegisterDriver("mysql", orm.DRMySQL)
 	var initOk bool
-	for key, value := range configerMap {
+	for key, dbConfig := range dbConfigs {
 		if key == "default" {
 			initOk = true
 		}
 
-		valueMap := value.(map[string]interface{})
-
 		if err := orm.RegisterDataBase(key, "mysql",
-			valueMap["dsn"].(string),
-			valueMap["maxIdle"].(int),
-			valueMap["maxOpen"].(int),
+			dbConfig.Dsn,
+			dbConfig.MaxIdle,
+			dbConfig.MaxOpen,
 		); err != nil {
 			panic(err)
 		}
@@ -48,6 +65,22 @@ func InitDb() {
 		panic("a database instance called default must be inited")
 	}
 
+	RegisterComponent(&FuncComponent{
+		ComponentName: mysqlComponent,
+		StopFunc: func(ctx context.Context) error {
+			for key := range dbConfigs {
+				db, err := orm.GetDB(key)
+				if err != nil {
+					return err
+				}
+				if err := db.Close(); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}, logComponent)
+
 	runMode, _ := config.String("runmode")
 	if runMode == "dev" {
 		orm.Debug = true
@@ -59,19 +92,22 @@ func InitDb() {
 // monica use `redigo` as a redis driver
 // this function read config from config file
 func InitRedis() {
-	redisConfig, _ := config.Map("redis")
-	if redisConfig == nil {
+	if !config.Has("redis") {
 		return
 	}
+	redisConfig := &RedisConfig{}
+	if err := config.Unmarshal("redis", redisConfig); err != nil {
+		panic(err)
+	}
 
-	address := redisConfig["address"].(string)
+	address := redisConfig.Address
 	if address == "" {
 		panic("redis config not declared: get blank address")
 	}
-	db := redisConfig["db"].(int)
+	db := redisConfig.Db
 	RedisPool = &redis.Pool{
-		MaxIdle:     5,
-		IdleTimeout: 240 * time.Second,
+		MaxIdle:     redisConfig.MaxIdle,
+		IdleTimeout: redisConfig.IdleTimeout,
 		Dial: func() (redis.Conn, error) {
 			c, err := redis.Dial("tcp", address)
 			if err != nil {
@@ -94,4 +130,11 @@ func InitRedis() {
 
 		},
 	}
+	pool := RedisPool
+	RegisterComponent(&FuncComponent{
+		ComponentName: redisComponent,
+		StopFunc: func(ctx context.Context) error {
+			return pool.Close()
+		},
+	}, logComponent)
 }
@@ -0,0 +1,316 @@
+package monica
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 组件停止的默认超时时间
+const DefaultStopTimeout = 10 * time.Second
+
+// 组件, 如webserver, thrift server, db, redis, thrift线程池, log等
+// 组件按依赖的顺序启动, 按相反的顺序停止
+type Component interface {
+	Name() string
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// 组件可以实现该接口指定自己的停止超时时间, 否则使用 DefaultStopTimeout
+type StopTimeouter interface {
+	StopTimeout() time.Duration
+}
+
+// 用函数实现的组件, StartFunc/StopFunc 为nil时什么都不做
+type FuncComponent struct {
+	ComponentName string
+	StartFunc     func(ctx context.Context) error
+	StopFunc      func(ctx context.Context) error
+	// 停止的超时时间, 为0时使用 DefaultStopTimeout
+	Timeout time.Duration
+}
+
+func (c *FuncComponent) Name() string {
+	return c.ComponentName
+}
+
+func (c *FuncComponent) Start(ctx context.Context) error {
+	if c.StartFunc == nil {
+		return nil
+	}
+	return c.StartFunc(ctx)
+}
+
+func (c *FuncComponent) Stop(ctx context.Context) error {
+	if c.StopFunc == nil {
+		return nil
+	}
+	return c.StopFunc(ctx)
+}
+
+func (c *FuncComponent) StopTimeout() time.Duration {
+	return c.Timeout
+}
+
+type componentEntry struct {
+	component Component
+	dependsOn []string
+	started   bool
+}
+
+// 管理组件的启动与停止
+type Lifecycle struct {
+	lock sync.Mutex
+	// 保证同一时间只有一个 Stop 在执行, 停止组件时不持有lock
+	stopLock sync.Mutex
+	entries  []*componentEntry
+	// 已经启动的组件, 按启动的顺序
+	started []*componentEntry
+	// Start 之后注册的组件会立即启动
+	running bool
+	// Stop 开始之后为1, 直到下一次 Start
+	stopping int32
+}
+
+func NewLifecycle() *Lifecycle {
+	return &Lifecycle{}
+}
+
+// 注册组件, dependsOn 为依赖的组件的名称, 被依赖的组件先启动后停止
+// 没有注册的依赖会被忽略, 以 `*` 结尾的名称匹配该前缀的所有组件, 如 `thriftpool:*`
+// Start 之后注册的组件会立即启动, 启动失败时panic
+// Stop 开始之后注册的组件不会启动, 等到下一次 Start 时再启动
+func (l *Lifecycle) Register(component Component, dependsOn ...string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if err := l.addLocked([]Component{component}, dependsOn); err != nil {
+		panic(err.Error())
+	}
+	if l.running && !l.Stopping() {
+		if err := l.start(context.Background()); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// 注册组件但不启动, 由之后的 Start 一起启动, 有名称重复的组件时一个都不注册并返回错误
+func (l *Lifecycle) add(components []Component, dependsOn ...string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.addLocked(components, dependsOn)
+}
+
+func (l *Lifecycle) addLocked(components []Component, dependsOn []string) error {
+	names := make(map[string]bool, len(l.entries)+len(components))
+	for _, entry := range l.entries {
+		names[entry.component.Name()] = true
+	}
+	for _, component := range components {
+		if names[component.Name()] {
+			return fmt.Errorf("component %s already registered", component.Name())
+		}
+		names[component.Name()] = true
+	}
+	for _, component := range components {
+		l.entries = append(l.entries, &componentEntry{
+			component: component,
+			dependsOn: dependsOn,
+		})
+	}
+	return nil
+}
+
+// 按依赖的顺序启动所有还没有启动的组件
+// 某个组件启动失败时, 停止本次已经启动的组件并返回错误
+func (l *Lifecycle) Start(ctx context.Context) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.running = true
+	atomic.StoreInt32(&l.stopping, 0)
+	return l.start(ctx)
+}
+
+// 调用时需要持有lock
+func (l *Lifecycle) start(ctx context.Context) error {
+	order, err := l.startOrder()
+	if err != nil {
+		return err
+	}
+	for i, entry := range order {
+		if err := entry.component.Start(ctx); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				order[j].started = false
+				l.stopEntry(ctx, order[j])
+			}
+			l.started = l.started[:len(l.started)-i]
+			return fmt.Errorf("start component %s error: %s", entry.component.Name(), err)
+		}
+		entry.started = true
+		l.started = append(l.started, entry)
+	}
+	return nil
+}
+
+// 按依赖的相反顺序停止所有已经启动的组件, 每个组件都有自己的超时时间
+// 超时的组件会被记录并跳过, 不会阻塞后面的组件
+// 停止顺序在持有锁时确定, 停止组件时不持有锁, 组件的Stop中可以调用 Register 等方法
+func (l *Lifecycle) Stop(ctx context.Context) error {
+	l.stopLock.Lock()
+	defer l.stopLock.Unlock()
+	atomic.StoreInt32(&l.stopping, 1)
+
+	l.lock.Lock()
+	order := l.stopOrder()
+	for _, entry := range order {
+		entry.started = false
+	}
+	l.started = nil
+	l.running = false
+	l.lock.Unlock()
+
+	var failed []string
+	for i := len(order) - 1; i >= 0; i-- {
+		entry := order[i]
+		if err := l.stopEntry(ctx, entry); err != nil {
+			log.Println("WARNING:", err)
+			failed = append(failed, entry.component.Name())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("stop component %s failed", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// 是否已经开始停止, 停止过程中组件退出是正常的
+func (l *Lifecycle) Stopping() bool {
+	return atomic.LoadInt32(&l.stopping) != 0
+}
+
+// 停止一个组件, 超时时返回错误, 组件的Stop会在后台继续执行
+func (l *Lifecycle) stopEntry(ctx context.Context, entry *componentEntry) error {
+	component := entry.component
+	timeout := DefaultStopTimeout
+	if timeouter, ok := component.(StopTimeouter); ok && timeouter.StopTimeout() > 0 {
+		timeout = timeouter.StopTimeout()
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	log.Println("INFO: stopping", component.Name())
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("%v", r)
+			}
+		}()
+		done <- component.Stop(ctx)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("stop component %s error: %s", component.Name(), err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("stop component %s timeout after %s, skip it", component.Name(), timeout)
+	}
+}
+
+// 还没有启动的组件的启动顺序, 依赖存在循环时返回错误
+func (l *Lifecycle) startOrder() ([]*componentEntry, error) {
+	order := make([]*componentEntry, 0)
+	// 0 未访问 1 访问中 2 已访问
+	state := make(map[*componentEntry]int, len(l.entries))
+	var visit func(entry *componentEntry, path []string) error
+	visit = func(entry *componentEntry, path []string) error {
+		path = append(path, entry.component.Name())
+		switch state[entry] {
+		case 1:
+			return fmt.Errorf("component dependency cycle: %s", strings.Join(path, " -> "))
+		case 2:
+			return nil
+		}
+		state[entry] = 1
+		for _, dep := range l.dependencies(entry) {
+			if err := visit(dep, path); err != nil {
+				return err
+			}
+		}
+		state[entry] = 2
+		if !entry.started {
+			order = append(order, entry)
+		}
+		return nil
+	}
+	for _, entry := range l.entries {
+		if err := visit(entry, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// 已经启动的组件按依赖排序, 被依赖的在前
+// Start 之后注册的组件会立即启动, 可能比它依赖的组件先启动, 所以不能直接使用启动的顺序
+func (l *Lifecycle) stopOrder() []*componentEntry {
+	order := make([]*componentEntry, 0, len(l.started))
+	visited := make(map[*componentEntry]bool, len(l.started))
+	var visit func(entry *componentEntry)
+	visit = func(entry *componentEntry) {
+		if visited[entry] || !entry.started {
+			return
+		}
+		visited[entry] = true
+		for _, dep := range l.dependencies(entry) {
+			visit(dep)
+		}
+		order = append(order, entry)
+	}
+	for _, entry := range l.started {
+		visit(entry)
+	}
+	return order
+}
+
+// 组件依赖的所有已注册的组件
+func (l *Lifecycle) dependencies(entry *componentEntry) []*componentEntry {
+	deps := make([]*componentEntry, 0, len(entry.dependsOn))
+	for _, name := range entry.dependsOn {
+		prefix := strings.TrimSuffix(name, "*")
+		for _, other := range l.entries {
+			if other == entry {
+				continue
+			}
+			otherName := other.component.Name()
+			if otherName == name || prefix != name && strings.HasPrefix(otherName, prefix) {
+				deps = append(deps, other)
+			}
+		}
+	}
+	return deps
+}
+
+// 全局的组件管理
+var lifecycle = NewLifecycle()
+
+// 注册组件, 详见 Lifecycle.Register
+func RegisterComponent(component Component, dependsOn ...string) {
+	lifecycle.Register(component, dependsOn...)
+}
+
+// 启动所有注册的组件, 已经启动的组件不会重复启动
+func StartComponents(ctx context.Context) error {
+	return lifecycle.Start(ctx)
+}
+
+// 停止所有已经启动的组件
+func StopComponents(ctx context.Context) error {
+	return lifecycle.Stop(ctx)
+}
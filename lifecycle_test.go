@@ -0,0 +1,143 @@
+package monica
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLifecycle(t *testing.T) {
+	var events []string
+	component := func(name string) Component {
+		return &FuncComponent{
+			ComponentName: name,
+			StartFunc: func(ctx context.Context) error {
+				events = append(events, "start "+name)
+				return nil
+			},
+			StopFunc: func(ctx context.Context) error {
+				events = append(events, "stop "+name)
+				return nil
+			},
+			Timeout: 50 * time.Millisecond,
+		}
+	}
+
+	l := NewLifecycle()
+	l.Register(component("webserver"), "mysql", "thriftpool:*", "redis")
+	l.Register(component("thriftpool:upserver"), "log")
+	l.Register(component("mysql"), "log")
+	release := make(chan struct{})
+	defer close(release)
+	l.Register(&FuncComponent{
+		ComponentName: "hung",
+		StopFunc: func(ctx context.Context) error {
+			<-release
+			return nil
+		},
+		Timeout: 50 * time.Millisecond,
+	}, "webserver")
+	l.Register(component("log"))
+	if err := l.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"start log", "start mysql", "start thriftpool:upserver", "start webserver"}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("got %v", events)
+	}
+
+	// 启动之后注册的组件会立即启动
+	l.Register(component("cron"), "log")
+	if events[len(events)-1] != "start cron" {
+		t.Errorf("got %v", events)
+	}
+
+	events = nil
+	begin := time.Now()
+	if err := l.Stop(context.Background()); err == nil {
+		t.Error("hung component should return an error")
+	}
+	if time.Since(begin) > 500*time.Millisecond {
+		t.Error("hung component should be skipped")
+	}
+	expected = []string{"stop cron", "stop webserver", "stop thriftpool:upserver", "stop mysql", "stop log"}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("got %v", events)
+	}
+}
+
+func TestLifecycleCycle(t *testing.T) {
+	l := NewLifecycle()
+	l.Register(&FuncComponent{ComponentName: "a"}, "b")
+	l.Register(&FuncComponent{ComponentName: "b"}, "a")
+	if err := l.Start(context.Background()); err == nil {
+		t.Error("should return dependency cycle error")
+	}
+}
+
+// Start 之后注册的被依赖的组件也在依赖它的组件之后停止
+func TestLifecycleStopOrder(t *testing.T) {
+	var events []string
+	component := func(name string) Component {
+		return &FuncComponent{
+			ComponentName: name,
+			StopFunc: func(ctx context.Context) error {
+				events = append(events, "stop "+name)
+				return nil
+			},
+		}
+	}
+	l := NewLifecycle()
+	l.Register(component("log"))
+	if err := l.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	l.Register(component("beforeQuitWait#0"), "webserver")
+	l.Register(component("webserver"), "log")
+	if err := l.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"stop beforeQuitWait#0", "stop webserver", "stop log"}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("got %v", events)
+	}
+}
+
+// Stop 过程中注册的组件不会启动, 组件的Stop中可以调用 Register
+func TestLifecycleRegisterWhenStopping(t *testing.T) {
+	var events []string
+	l := NewLifecycle()
+	l.Register(&FuncComponent{
+		ComponentName: "webserver",
+		StopFunc: func(ctx context.Context) error {
+			l.Register(&FuncComponent{
+				ComponentName: "cron",
+				StartFunc: func(ctx context.Context) error {
+					events = append(events, "start cron")
+					return nil
+				},
+			})
+			events = append(events, "stop webserver")
+			return nil
+		},
+	})
+	if err := l.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"stop webserver"}; !reflect.DeepEqual(events, expected) {
+		t.Errorf("got %v", events)
+	}
+
+	// 下一次 Start 时启动
+	events = nil
+	if err := l.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"start cron"}; !reflect.DeepEqual(events, expected) {
+		t.Errorf("got %v", events)
+	}
+}
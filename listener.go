@@ -0,0 +1,228 @@
+package monica
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// 重启时从父进程继承的监听, 按 ExtraFiles 的顺序以逗号分隔, 形如 `tcp://:8080,tcp://:9090`
+	MONICA_LISTENERS = "MONICA_LISTENERS"
+	// 子进程准备好之后写入的管道的文件描述符
+	MONICA_READY_FD = "MONICA_READY_FD"
+)
+
+// ExtraFiles 中的第一个文件的描述符
+const extraFilesStart = 3
+
+var (
+	listenersLock sync.Mutex
+	// 当前进程正在使用的监听, 重启时传递给子进程
+	activeListeners []*inheritableListener
+	// 从父进程继承的还没有被使用的监听
+	inheritedListeners map[string]net.Listener
+	inheritedOnce      sync.Once
+	// 重启时监听已经交给了新的进程, 关闭时不能删除unix socket文件
+	listenersHandedOver int32
+)
+
+// 可以传递给子进程的监听, 关闭后不再传递
+type inheritableListener struct {
+	net.Listener
+	key string
+	// unix socket文件的路径, 关闭时删除
+	socketPath string
+}
+
+func (l *inheritableListener) Close() error {
+	listenersLock.Lock()
+	for i, active := range activeListeners {
+		if active == l {
+			activeListeners = append(activeListeners[:i], activeListeners[i+1:]...)
+			break
+		}
+	}
+	listenersLock.Unlock()
+	err := l.Listener.Close()
+	if l.socketPath != "" && atomic.LoadInt32(&listenersHandedOver) == 0 {
+		os.Remove(l.socketPath)
+	}
+	return err
+}
+
+func listenerKey(network, addr string) string {
+	return fmt.Sprintf("%s://%s", network, addr)
+}
+
+// 读取父进程传递的监听, 环境变量会被清除
+func loadInheritedListeners() {
+	inheritedListeners = make(map[string]net.Listener)
+	value := os.Getenv(MONICA_LISTENERS)
+	os.Unsetenv(MONICA_LISTENERS)
+	if value == "" {
+		return
+	}
+	for i, key := range strings.Split(value, ",") {
+		f := os.NewFile(uintptr(extraFilesStart+i), key)
+		listener, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			log.Println("WARNING: inherit listener", key, "error", err)
+			continue
+		}
+		inheritedListeners[key] = listener
+	}
+}
+
+// 监听network上的addr, 如 Listen("tcp", ":8080") 或者 Listen("unix", "/run/app.sock")
+// 通过 `restart` 或者 SIGUSR2 重启时, 子进程会直接使用父进程的同一个监听, 不会有连接被拒绝
+// unix socket文件在监听前如果已经存在且没有进程在使用会被删除, 关闭监听时删除
+func Listen(network, addr string) (net.Listener, error) {
+	inheritedOnce.Do(loadInheritedListeners)
+	key := listenerKey(network, addr)
+
+	listenersLock.Lock()
+	defer listenersLock.Unlock()
+	listener, ok := inheritedListeners[key]
+	if ok {
+		delete(inheritedListeners, key)
+		log.Println("INFO: inherit listener", key)
+	} else {
+		if network == "unix" {
+			if err := removeStaleSocket(addr); err != nil {
+				return nil, err
+			}
+		}
+		var err error
+		if listener, err = net.Listen(network, addr); err != nil {
+			return nil, err
+		}
+	}
+	inheritable := &inheritableListener{Listener: listener, key: key}
+	if unixListener, ok := listener.(*net.UnixListener); ok {
+		// 由 inheritableListener 在没有交给新的进程时删除
+		unixListener.SetUnlinkOnClose(false)
+		inheritable.socketPath = addr
+	}
+	activeListeners = append(activeListeners, inheritable)
+	return inheritable, nil
+}
+
+// 删除没有进程在使用的unix socket文件, 进程崩溃或者被kill时socket文件不会被删除
+func removeStaleSocket(path string) error {
+	stat, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if stat.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s already exists and is not a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use by another process", path)
+	}
+	log.Println("INFO: remove stale socket", path)
+	return os.Remove(path)
+}
+
+// 设置unix socket文件的权限与所有者, owner 形如 `user` 或者 `user:group`, 为空时不修改
+func chownSocket(path string, mode os.FileMode, owner string) error {
+	if err := os.Chmod(path, mode); err != nil {
+		return err
+	}
+	if owner == "" {
+		return nil
+	}
+	userName, groupName := owner, ""
+	if i := strings.Index(owner, ":"); i >= 0 {
+		userName, groupName = owner[:i], owner[i+1:]
+	}
+	u, err := user.Lookup(userName)
+	if err != nil {
+		return err
+	}
+	uid, _ := strconv.Atoi(u.Uid)
+	gid, _ := strconv.Atoi(u.Gid)
+	if groupName != "" {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			return err
+		}
+		gid, _ = strconv.Atoi(g.Gid)
+	}
+	return os.Chown(path, uid, gid)
+}
+
+// 重启时新的进程已经准备好, 之后关闭监听时不再删除unix socket文件
+func handOverListeners() {
+	atomic.StoreInt32(&listenersHandedOver, 1)
+}
+
+// 当前所有监听的文件, 以及对应的 MONICA_LISTENERS 环境变量
+// 调用者需要关闭返回的文件
+func listenerFiles() ([]*os.File, string, error) {
+	listenersLock.Lock()
+	defer listenersLock.Unlock()
+	files := make([]*os.File, 0, len(activeListeners))
+	keys := make([]string, 0, len(activeListeners))
+	for _, listener := range activeListeners {
+		filer, ok := listener.Listener.(interface {
+			File() (*os.File, error)
+		})
+		if !ok {
+			continue
+		}
+		f, err := filer.File()
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, "", fmt.Errorf("get file of listener %s error: %s", listener.key, err)
+		}
+		files = append(files, f)
+		keys = append(keys, listener.key)
+	}
+	return files, strings.Join(keys, ","), nil
+}
+
+// 通知重启(restart 或者 SIGUSR2)时的父进程新的进程已经准备好, 并关闭没有用到的继承的监听
+// Run 在所有的服务启动之后会调用, 不使用 Run 自己监听的服务需要在开始服务之后调用
+// 否则重启时父进程会在 `restart_timeout` 之后杀掉新的进程
+// 不是通过重启启动的进程或者已经调用过时什么都不做
+func Ready() {
+	inheritedOnce.Do(loadInheritedListeners)
+	listenersLock.Lock()
+	for key, listener := range inheritedListeners {
+		log.Println("INFO: close unused inherited listener", key)
+		listener.Close()
+	}
+	inheritedListeners = map[string]net.Listener{}
+	listenersLock.Unlock()
+
+	value := os.Getenv(MONICA_READY_FD)
+	os.Unsetenv(MONICA_READY_FD)
+	if value == "" {
+		return
+	}
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		log.Println("WARNING: invalid", MONICA_READY_FD, value)
+		return
+	}
+	f := os.NewFile(uintptr(fd), "ready")
+	defer f.Close()
+	if _, err := f.Write([]byte("ready")); err != nil {
+		log.Println("WARNING: notify parent ready error", err)
+	}
+}
@@ -0,0 +1,79 @@
+package monica
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monica")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.sock")
+
+	// 崩溃的进程留下的socket文件
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listener, err := Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 正在使用的socket文件不会被删除
+	if _, err := Listen("unix", path); err == nil {
+		t.Error("socket in use should not be removed")
+	}
+	if err := chownSocket(path, 0600, ""); err != nil {
+		t.Fatal(err)
+	}
+	if stat, err := os.Stat(path); err != nil || stat.Mode().Perm() != 0600 {
+		t.Errorf("got mode %v %v", stat.Mode(), err)
+	}
+
+	listener.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("socket file should be removed after close")
+	}
+
+	// 不是socket的文件不会被删除
+	ioutil.WriteFile(path, nil, 0644)
+	if _, err := Listen("unix", path); err == nil {
+		t.Error("regular file should not be removed")
+	}
+}
+
+func TestReady(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	// Ready 会关闭传入的fd
+	fd, err := syscall.Dup(int(w.Fd()))
+	w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv(MONICA_READY_FD, strconv.Itoa(fd))
+	Ready()
+	// 第二次调用什么都不做
+	Ready()
+	content, err := ioutil.ReadAll(r)
+	if err != nil || string(content) != "ready" {
+		t.Errorf("got %q %v", content, err)
+	}
+	if value := os.Getenv(MONICA_READY_FD); value != "" {
+		t.Errorf("%s is not cleared: %s", MONICA_READY_FD, value)
+	}
+}
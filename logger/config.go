@@ -2,12 +2,11 @@ package logger
 
 import (
 	"fmt"
+	"io"
 
 )
 
 var (
-	handlersMap map[string]Handler = map[string]Handler{}
-
 	handlerInitFunction map[string]FactoryFunc = map[string]FactoryFunc{}
 )
 
@@ -15,6 +14,12 @@ func RegisterHandlerInitFunction(name string, initFunction FactoryFunc) {
 	handlerInitFunction[name] = initFunction
 }
 
+// whether a handler type has been registered
+func HandlerTypeRegistered(name string) bool {
+	_, ok := handlerInitFunction[name]
+	return ok
+}
+
 // handler factory funct to create handler
 type FactoryFunc func(map[string]interface{}) (Handler, error)
 
@@ -30,6 +35,13 @@ type HandlerOption struct {
 
 // a global init handler method
 func (option *HandlerOption) InitHandler() {
+	handler := option.newHandler()
+	updateState(func(handlers map[string]Handler, loggers map[string]*MonicaLogger) {
+		handlers[option.Name] = handler
+	})
+}
+
+func (option *HandlerOption) newHandler() Handler {
 	factoryFunc, ok := handlerInitFunction[option.Type]
 	if !ok {
 		panic("not support handler type")
@@ -39,8 +51,7 @@ func (option *HandlerOption) InitHandler() {
 	if err != nil {
 		panic(err)
 	}
-
-	handlersMap[option.Name] = handler
+	return handler
 }
 
 type LoggerOption struct {
@@ -55,6 +66,29 @@ type LoggerOption struct {
 }
 
 func (option *LoggerOption) InitLogger() {
+	updateState(func(handlers map[string]Handler, loggers map[string]*MonicaLogger) {
+		loggers[option.Name] = option.newLogger(handlers)
+	})
+}
+
+// publish a copy of the current state changed by update
+func updateState(update func(handlers map[string]Handler, loggers map[string]*MonicaLogger)) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	old := loadState()
+	handlers := make(map[string]Handler, len(old.handlers)+1)
+	for name, handler := range old.handlers {
+		handlers[name] = handler
+	}
+	loggers := make(map[string]*MonicaLogger, len(old.loggers)+1)
+	for name, logger := range old.loggers {
+		loggers[name] = logger
+	}
+	update(handlers, loggers)
+	currentState.Store(newLoggerState(handlers, loggers, old.initialized))
+}
+
+func (option *LoggerOption) newLogger(handlersMap map[string]Handler) *MonicaLogger {
 	handlers := make([]Handler, 0, len(option.Handlers))
 	for _, handlerName := range option.Handlers {
 		handler, ok := handlersMap[handlerName]
@@ -63,7 +97,7 @@ func (option *LoggerOption) InitLogger() {
 		}
 		handlers = append(handlers, handler)
 	}
-	loggerMap[option.Name] = &MonicaLogger{
+	return &MonicaLogger{
 		handlers:   handlers,
 		level:      option.Level,
 		loggerName: option.Name,
@@ -71,15 +105,74 @@ func (option *LoggerOption) InitLogger() {
 	}
 }
 
+// init handlers and loggers, it can be called again to reload the configure
+// all the handlers and loggers are created before replacing the old ones,
+// so the old configure is kept if it panics.
+// loggers returned by GetLogger use the new configure once it is installed, the
+// removed ones will use the nearest parent logger. the old handlers are closed.
+// the root logger is kept if the new configure does not have one
 func InitLogger(handlerOptions []*HandlerOption, loggerOption []*LoggerOption) {
-	for _, option := range handlerOptions {
-		option.InitHandler()
+	prepared, err := PrepareLogger(handlerOptions, loggerOption)
+	if err != nil {
+		panic(err)
 	}
+	prepared.Install()
+}
 
+// handlers and loggers created by PrepareLogger but not installed yet
+type PreparedLogger struct {
+	handlers map[string]Handler
+	loggers  map[string]*MonicaLogger
+}
+
+// create the handlers and loggers without replacing the current ones,
+// so the caller can decide whether to install them after other checks.
+// the handlers already created are closed if it fails
+func PrepareLogger(handlerOptions []*HandlerOption, loggerOption []*LoggerOption) (prepared *PreparedLogger, err error) {
+	handlers := make(map[string]Handler, len(handlerOptions))
+	defer func() {
+		if r := recover(); r != nil {
+			closeHandlers(handlers)
+			err = fmt.Errorf("init logger error: %v", r)
+		}
+	}()
+	for _, option := range handlerOptions {
+		handlers[option.Name] = option.newHandler()
+	}
+	loggers := make(map[string]*MonicaLogger, len(loggerOption))
 	for _, option := range loggerOption {
-		option.InitLogger()
+		loggers[option.Name] = option.newLogger(handlers)
+	}
+	return &PreparedLogger{handlers: handlers, loggers: loggers}, nil
+}
+
+// replace the current handlers and loggers, see InitLogger
+// the old handlers are closed after the new ones are published, the records
+// still being handled by them at that time are dropped
+func (prepared *PreparedLogger) Install() {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	old := loadState()
+	loggers := prepared.loggers
+	oldHandlers := old.handlers
+	if _, ok := loggers["/"]; !ok {
+		root := old.loggers["/"]
+		loggers["/"] = root
+		// the handlers of the kept root logger are still in use
+		oldHandlers = make(map[string]Handler, len(old.handlers))
+		for name, handler := range old.handlers {
+			if !root.hasHandler(handler) {
+				oldHandlers[name] = handler
+			}
+		}
 	}
-	initialized = true
+	currentState.Store(newLoggerState(prepared.handlers, loggers, true))
+	closeHandlers(oldHandlers)
+}
+
+// close the handlers if they will not be installed
+func (prepared *PreparedLogger) Discard() error {
+	return closeHandlers(prepared.handlers)
 }
 
 
@@ -89,17 +182,38 @@ type LoggerConfig struct {
 }
 
 
+// close all the handlers which implement io.Closer, such as FileHandler
+func CloseHandlers() error {
+	return closeHandlers(loadState().handlers)
+}
+
+func closeHandlers(handlersMap map[string]Handler) error {
+	var firstErr error
+	for name, handler := range handlersMap {
+		closer, ok := handler.(io.Closer)
+		if !ok {
+			continue
+		}
+		if err := closer.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("close handler %s error: %s", name, err)
+		}
+	}
+	return firstErr
+}
+
 // 初始化日志
 func InitLoggerByConfigure(config *LoggerConfig) {
-	defer func() {
-		initialized = true
-	}()
+	defer PostInit()
 
 	InitLogger(config.Handlers, config.Loggers)
 }
 
 
 func PostInit() {
-	initialized = true
-
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	old := loadState()
+	if !old.initialized {
+		currentState.Store(newLoggerState(old.handlers, old.loggers, true))
+	}
 }
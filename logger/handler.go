@@ -42,6 +42,16 @@ func (handler *ThreadSafeHandler) Handle(record Recorder) error {
 	return handler.handler.Handle(record)
 }
 
+// close the wrapped handler if it is an io.Closer
+func (handler *ThreadSafeHandler) Close() error {
+	handler.Lock()
+	defer handler.Unlock()
+	if closer, ok := handler.handler.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
 type Rotator interface {
 	shouldRollover() bool
 	doRollover()
@@ -60,6 +70,8 @@ func (handler *BaseHandler) Handle(record Recorder) error {
 type FileHandler struct {
 	*BaseHandler
 	baseFileName string
+	// the records are dropped after Close
+	closed bool
 }
 
 // new a file handler
@@ -102,6 +114,9 @@ func (handler *FileHandler) open() (io.WriteCloser, error) {
 }
 
 func (handler *FileHandler) Handle(record Recorder) error {
+	if handler.closed {
+		return nil
+	}
 	if handler.writer == nil {
 		handler.writer, _ = handler.open()
 	}
@@ -113,18 +128,36 @@ func (handler *FileHandler) Handle(record Recorder) error {
 	return nil
 }
 
+// close the log file, the records after Close are dropped
+func (handler *FileHandler) Close() error {
+	handler.closed = true
+	if handler.writer == nil {
+		return nil
+	}
+	err := handler.writer.Close()
+	handler.writer = nil
+	return err
+}
+
 type RotatingFileHandler struct {
 	handler *FileHandler
 	rotator Rotator
 }
 
 func (handler *RotatingFileHandler) Handle(record Recorder) error {
+	if handler.handler.closed {
+		return nil
+	}
 	if handler.rotator.shouldRollover() {
 		handler.rotator.doRollover()
 	}
 	return handler.handler.Handle(record)
 }
 
+func (handler *RotatingFileHandler) Close() error {
+	return handler.handler.Close()
+}
+
 func NewTimeRotatingFileHandler(baseFileName, formatter, when string, backupCount int) (*RotatingFileHandler, error) {
 	fileHandler, err := NewFileHandler(baseFileName, formatter)
 	if err != nil {
@@ -3,27 +3,58 @@ package logger
 import (
 	"fmt"
 	"path"
+	"sync"
+	"sync/atomic"
 )
 
 const formatter = `{{.Time.String }}  {{.Level.String }} {{.FileName }} {{.FuncName}} {{ .LineNo}} {{ .Message }}
 `
 
-// save loggers in a tree like structure
+// the handlers and loggers in use, they are never modified after published,
+// reloading the configure publishes a new loggerState
+type loggerState struct {
+	handlers map[string]Handler
+	// save loggers in a tree like structure
+	loggers     map[string]*MonicaLogger
+	initialized bool
+
+	propagateLock sync.RWMutex
+	propagate     map[string][]*MonicaLogger
+}
+
 var (
-	loggerMap          map[string]*MonicaLogger
-	propagateLoggerMap map[string][]*MonicaLogger
-	initialized        bool
+	// *loggerState
+	currentState atomic.Value
+	// serialize the writers of currentState
+	stateLock sync.Mutex
 )
 
+func newLoggerState(handlers map[string]Handler, loggers map[string]*MonicaLogger, initialized bool) *loggerState {
+	return &loggerState{
+		handlers:    handlers,
+		loggers:     loggers,
+		initialized: initialized,
+		propagate:   make(map[string][]*MonicaLogger),
+	}
+}
+
+func loadState() *loggerState {
+	return currentState.Load().(*loggerState)
+}
+
+// the returned logger looks up the configured logger every time it logs,
+// so it always uses the current configure after reloading
 func GetLogger(name string) *MonicaLogger {
-	if !initialized {
-		return &MonicaLogger{
-			loggerPath: name,
-			isCache:    true,
-		}
+	return &MonicaLogger{
+		loggerPath: name,
+		isCache:    true,
 	}
+}
+
+// the nearest configured logger of name
+func (state *loggerState) getLogger(name string) *MonicaLogger {
 	for {
-		logger, ok := loggerMap[name]
+		logger, ok := state.loggers[name]
 		if ok {
 			return logger
 		}
@@ -38,14 +69,14 @@ func getRootLogger() *MonicaLogger {
 	return GetLogger("/")
 }
 
-func getParentLoggers(name string) []*MonicaLogger {
+func (state *loggerState) getParentLoggers(name string) []*MonicaLogger {
 	loggers := make([]*MonicaLogger, 0, 0)
 	if name == "/" {
 		return loggers
 	}
 	for {
 		name = path.Dir(name)
-		logger, ok := loggerMap[name]
+		logger, ok := state.loggers[name]
 		if ok {
 			loggers = append(loggers, logger)
 		}
@@ -57,13 +88,17 @@ func getParentLoggers(name string) []*MonicaLogger {
 	return loggers
 }
 
-// this function is not thread safe, but it do not have too much problems
-func getParentLoggersCache(name string) []*MonicaLogger {
-	if loggers, ok := propagateLoggerMap[name]; ok {
+func (state *loggerState) getParentLoggersCache(name string) []*MonicaLogger {
+	state.propagateLock.RLock()
+	loggers, ok := state.propagate[name]
+	state.propagateLock.RUnlock()
+	if ok {
 		return loggers
 	}
-	loggers := getParentLoggers(name)
-	propagateLoggerMap[name] = loggers
+	loggers = state.getParentLoggers(name)
+	state.propagateLock.Lock()
+	state.propagate[name] = loggers
+	state.propagateLock.Unlock()
 	return loggers
 }
 
@@ -127,17 +162,27 @@ func (logger *MonicaLogger) logEmit(record *Record) {
 
 }
 
+func (logger *MonicaLogger) hasHandler(handler Handler) bool {
+	for _, h := range logger.handlers {
+		if h == handler {
+			return true
+		}
+	}
+	return false
+}
+
 func (logger *MonicaLogger) log(level Level, msg string) {
+	state := loadState()
 	if logger.isCache {
-		if !initialized {
+		if !state.initialized {
 			panic("cannot use logger before initialize")
 		}
-		logger = GetLogger(logger.loggerPath)
+		logger = state.getLogger(logger.loggerPath)
 	}
 	record := NewRecord(level, msg)
 	logger.logEmit(record)
 	if logger.Propagate {
-		for _, logger := range getParentLoggersCache(logger.loggerName) {
+		for _, logger := range state.getParentLoggersCache(logger.loggerName) {
 			logger.logEmit(record)
 
 		}
@@ -185,13 +230,11 @@ func (logger *MonicaLogger) Fatalf(format string, args ...interface{}) {
 }
 
 func init() {
-	propagateLoggerMap = make(map[string][]*MonicaLogger, 0)
 	handler, _ := NewFileHandler("/dev/stdout", formatter)
 	rootLogger := &MonicaLogger{
 		handlers:   []Handler{NewThreadSafeHandler(handler)},
 		level:      DebugLevel,
 		loggerName: "/",
 	}
-	loggerMap = make(map[string]*MonicaLogger, 0)
-	loggerMap["/"] = rootLogger
+	currentState.Store(newLoggerState(map[string]Handler{}, map[string]*MonicaLogger{"/": rootLogger}, false))
 }
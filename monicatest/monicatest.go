@@ -0,0 +1,95 @@
+// 基于monica的应用的测试工具
+//
+// 不需要写临时的配置文件, 也不需要切换工作目录
+//
+//	func TestHandler(t *testing.T) {
+//		server := monicatest.NewServer(t, map[string]interface{}{
+//			"server": map[string]interface{}{"urlPrefix": "/api"},
+//			"upstream": "http://127.0.0.1:9000",
+//		}, func(ws *webserver.WebServer) {
+//			ws.Get("/ping", ping)
+//		})
+//		defer server.Close()
+//
+//		resp, err := http.Get(server.URL + "/api/ping")
+//		...
+//	}
+package monicatest
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/DrWrong/monica"
+	"github.com/DrWrong/monica/config"
+	"github.com/DrWrong/monica/webserver"
+)
+
+// 全局状态在测试之间是共享的, 同一时间只允许一个替换
+var globalLock sync.Mutex
+
+// 用data替换全局配置, 返回恢复原有配置的函数
+//
+//	cfg, restore := monicatest.SetGlobalConfig(map[string]interface{}{...})
+//	defer restore()
+//	cfg.Set("server::urlPrefix", "/v2")
+func SetGlobalConfig(data map[string]interface{}) (*config.MapConfig, func()) {
+	globalLock.Lock()
+	old := config.GlobalConfiger
+	mapConfig := config.NewMapConfig(data)
+	config.GlobalConfiger = mapConfig
+	return mapConfig, func() {
+		config.GlobalConfiger = old
+		globalLock.Unlock()
+	}
+}
+
+// 测试用的webserver, 监听在httptest分配的本地端口上
+type Server struct {
+	*httptest.Server
+	WebServer *webserver.WebServer
+	Config    *config.MapConfig
+
+	restoreConfig func()
+	oldWebServer  *webserver.WebServer
+}
+
+// 用data作为全局配置启动一个webserver
+// server的配置从 `server` 部分读取, 端口与运行模式会被忽略
+// setup 用于注册路由与中间件, 与 BootStrapWeb 的 postInitFunc 相同
+// 测试结束后需要调用 Close 关闭server并恢复全局状态
+func NewServer(t testing.TB, data map[string]interface{}, setup func(ws *webserver.WebServer)) *Server {
+	mapConfig, restore := SetGlobalConfig(data)
+
+	serverConfig := &webserver.ServerConfig{ServerMode: "http"}
+	if mapConfig.Has("server") {
+		if err := config.Unmarshal("server", serverConfig); err != nil {
+			restore()
+			t.Fatal(err)
+		}
+	}
+
+	ws := webserver.New(serverConfig)
+	ws.SetURLPrefix(serverConfig.URLPrefix)
+	oldWebServer := monica.WebServer
+	monica.WebServer = ws
+	if setup != nil {
+		setup(ws)
+	}
+
+	return &Server{
+		Server:        httptest.NewServer(ws.Handler()),
+		WebServer:     ws,
+		Config:        mapConfig,
+		restoreConfig: restore,
+		oldWebServer:  oldWebServer,
+	}
+}
+
+// 关闭server并恢复全局的配置与 monica.WebServer
+func (s *Server) Close() {
+	s.Server.Close()
+	monica.WebServer = s.oldWebServer
+	s.restoreConfig()
+}
@@ -0,0 +1,53 @@
+package monicatest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/DrWrong/monica"
+	"github.com/DrWrong/monica/config"
+	"github.com/DrWrong/monica/webserver"
+)
+
+func TestNewServer(t *testing.T) {
+	server := NewServer(t, map[string]interface{}{
+		"server": map[string]interface{}{
+			"urlPrefix": "/api",
+		},
+		"greeting": "hello",
+	}, func(ws *webserver.WebServer) {
+		ws.Get("/greeting", func() string {
+			greeting, _ := config.String("greeting")
+			return greeting
+		})
+	})
+
+	if monica.WebServer != server.WebServer {
+		t.Error("monica.WebServer should be replaced")
+	}
+	if server.Config.Has("server::serverport") {
+		t.Error("config of the caller should not be changed")
+	}
+	get := func() string {
+		resp, err := http.Get(server.URL + "/api/greeting")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return string(body)
+	}
+	if body := get(); body != "hello" {
+		t.Errorf("got %s", body)
+	}
+	server.Config.Set("greeting", "hi")
+	if body := get(); body != "hi" {
+		t.Errorf("got %s", body)
+	}
+
+	server.Close()
+	if config.GlobalConfiger != nil || monica.WebServer != nil {
+		t.Error("global state should be restored")
+	}
+}
@@ -0,0 +1,252 @@
+package monica
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"syscall"
+	"time"
+
+	"gopkg.in/urfave/cli.v2"
+)
+
+// 进程管理的子命令, 除 start 外只需要读取配置
+var processCommands = map[string]bool{
+	"start":   true,
+	"stop":    true,
+	"restart": true,
+	"reload":  true,
+	"status":  true,
+}
+
+// status 的退出码, 与LSB的init脚本相同
+const (
+	// 进程正在运行
+	StatusRunning = 0
+	// pid文件存在但是进程已经退出
+	StatusDead = 1
+	// 进程没有运行
+	StatusStopped = 3
+)
+
+// 进程管理的子命令
+func (app *MonicaApp) newProcessCommands() []*cli.Command {
+	timeoutFlag := &cli.DurationFlag{
+		Name:  "timeout",
+		Value: DefaultShutdownTimeout,
+		Usage: "kill the process if it is still running after the timeout",
+	}
+	return []*cli.Command{
+		{
+			Name:  "start",
+			Usage: "start the server, the same as running without command",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:        "daemon",
+					Aliases:     []string{"d"},
+					Usage:       "run process in daemon",
+					Destination: &app.daemon,
+				},
+				&cli.BoolFlag{
+					Name:        "supervise",
+					Usage:       "run a master process which restarts the worker process when it crashes",
+					Destination: &app.supervise,
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if err := app.start(); err != nil {
+					return err
+				}
+				// 与不带子命令运行相同, 启动之后执行 App.Action
+				return c.App.Action(c)
+			},
+		},
+		{
+			Name:  "stop",
+			Usage: "stop the running process",
+			Flags: []cli.Flag{timeoutFlag},
+			Action: func(c *cli.Context) error {
+				return exitCode(app.stopProcess(c.Duration("timeout")))
+			},
+		},
+		{
+			Name:  "restart",
+			Usage: "start a new process with the listeners of the running one, then stop the old one",
+			Flags: []cli.Flag{timeoutFlag},
+			Action: func(c *cli.Context) error {
+				return exitCode(app.restartProcess(c.Duration("timeout")))
+			},
+		},
+		{
+			Name:  "reload",
+			Usage: "reload the config and loggers of the running process",
+			Action: func(c *cli.Context) error {
+				return exitCode(app.reloadProcess())
+			},
+		},
+		{
+			Name: "status",
+			Usage: fmt.Sprintf("print the pid, uptime and version of the running process, exit code is %d if running, "+
+				"%d if the pid file exists but the process is dead, %d if not running",
+				StatusRunning, StatusDead, StatusStopped),
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "json",
+					Usage: "print the status in json",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return exitCode(app.printStatus(os.Stdout, c.Bool("json")))
+			},
+		},
+	}
+}
+
+// 以code退出, 不再执行 App.Run 之后启动服务的代码
+func exitCode(code int) error {
+	return cli.Exit("", code)
+}
+
+// `-s` 参数, 与对应的子命令相同, 返回退出码
+func (app *MonicaApp) processSignal(signal string, timeout time.Duration) int {
+	switch signal {
+	case "status":
+		return app.printStatus(os.Stdout, false)
+	case "stop":
+		return app.stopProcess(timeout)
+	case "restart":
+		return app.restartProcess(timeout)
+	case "reload":
+		return app.reloadProcess()
+	}
+	log.Println("ERROR: unknown signal", signal, "accept status, stop, reload, restart")
+	return 2
+}
+
+// 进程的状态
+type ProcessStatus struct {
+	// running, dead 或者 stopped
+	Status string `json:"status"`
+	Pid    int    `json:"pid,omitempty"`
+	// 运行的秒数
+	Uptime  int64  `json:"uptime,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+// pid文件对应的进程的状态与 status 的退出码
+func (app *MonicaApp) processStatus() (*ProcessStatus, int) {
+	p := app.getProcess()
+	if p == nil {
+		return &ProcessStatus{Status: "stopped"}, StatusStopped
+	}
+	if !app.processAlive(p) {
+		return &ProcessStatus{Status: "dead", Pid: p.Pid}, StatusDead
+	}
+	status := &ProcessStatus{Status: "running", Pid: p.Pid}
+	if info := app.getProcessInfo(p.Pid); info != nil {
+		status.Uptime = int64(time.Since(info.StartTime).Seconds())
+		status.Version = info.Version
+	} else if stat, err := os.Stat(app.getPidFile()); err == nil {
+		// 没有进程信息时以pid文件的修改时间作为启动时间
+		status.Uptime = int64(time.Since(stat.ModTime()).Seconds())
+	}
+	return status, StatusRunning
+}
+
+// 输出进程的状态, 形如 `running pid=123 uptime=3600 version=1.0.0`, 返回退出码
+func (app *MonicaApp) printStatus(w io.Writer, asJSON bool) int {
+	status, code := app.processStatus()
+	if asJSON {
+		content, _ := json.Marshal(status)
+		fmt.Fprintln(w, string(content))
+		return code
+	}
+	switch code {
+	case StatusRunning:
+		fmt.Fprintf(w, "%s pid=%d uptime=%d version=%s\n", status.Status, status.Pid, status.Uptime, status.Version)
+	case StatusDead:
+		fmt.Fprintf(w, "%s pid=%d\n", status.Status, status.Pid)
+	default:
+		fmt.Fprintln(w, status.Status)
+	}
+	return code
+}
+
+// 发送SIGTERM并等待进程退出, 超过timeout进程还没有退出则发送SIGKILL
+func (app *MonicaApp) stopProcess(timeout time.Duration) int {
+	p := app.getProcess()
+	if p == nil || !app.processAlive(p) {
+		log.Println("INFO: process is gone")
+		return 0
+	}
+	if err := p.Signal(syscall.SIGTERM); err != nil {
+		log.Println("INFO: process is gone")
+		return 0
+	}
+
+	deadline := time.Now().Add(timeout)
+	killed := false
+	for {
+		time.Sleep(time.Second)
+		if err := p.Signal(syscall.Signal(0)); err != nil {
+			log.Println("INFO: process is gone")
+			return 0
+		}
+		if !killed && time.Now().After(deadline) {
+			log.Println("WARNING: process is still running after", timeout, "kill it", p.Pid)
+			p.Signal(syscall.SIGKILL)
+			// 被kill的进程没有机会删除pid文件
+			app.removePidFile()
+			killed = true
+			continue
+		}
+
+		log.Println("INFO: process is still running wait it exit", p.Pid)
+	}
+}
+
+// 发送SIGHUP
+func (app *MonicaApp) reloadProcess() int {
+	p := app.getProcess()
+	if p == nil || !app.processAlive(p) {
+		log.Println("ERROR: process is not running")
+		return 1
+	}
+	if err := p.Signal(syscall.SIGHUP); err != nil {
+		log.Println("ERROR: process is gone")
+		return 1
+	}
+	log.Println("INFO: reload signal sent to", p.Pid)
+	return 0
+}
+
+// 发送SIGUSR2并等待pid文件中的进程变为新的进程
+func (app *MonicaApp) restartProcess(timeout time.Duration) int {
+	p := app.getProcess()
+	if p == nil || !app.processAlive(p) {
+		log.Println("ERROR: process is not running")
+		return 1
+	}
+	if err := p.Signal(syscall.SIGUSR2); err != nil {
+		log.Println("ERROR: process is gone")
+		return 1
+	}
+	// supervise 模式下master会重启worker, pid文件不会变化, 重启期间的连接会被拒绝
+	if info := app.getProcessInfo(p.Pid); info != nil && info.Master {
+		log.Println("INFO: restart signal sent to master", p.Pid, "the worker restart is not zero-downtime")
+		return 0
+	}
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(time.Second)
+		if newProcess := app.getProcess(); newProcess != nil && newProcess.Pid != p.Pid && app.processAlive(newProcess) {
+			log.Println("INFO: process is restarted at", newProcess.Pid)
+			return 0
+		}
+		log.Println("INFO: process is restarting", p.Pid)
+	}
+	log.Println("WARNING: process is not restarted after", timeout)
+	return 1
+}
@@ -0,0 +1,127 @@
+package monica
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DrWrong/monica/config"
+	"gopkg.in/urfave/cli.v2"
+)
+
+// 在临时的运行目录中运行app, 返回退出码
+func runProcessCommand(t *testing.T, app *MonicaApp, args ...string) int {
+	code := 0
+	oldExiter := cli.OsExiter
+	cli.OsExiter = func(c int) { code = c }
+	defer func() { cli.OsExiter = oldExiter }()
+	if err := app.Run(append([]string{app.name}, args...)); err != nil {
+		if exitErr, ok := err.(cli.ExitCoder); ok {
+			return exitErr.ExitCode()
+		}
+		t.Fatal(err)
+	}
+	return code
+}
+
+func newTestApp(t *testing.T) (*MonicaApp, string) {
+	dir, err := ioutil.TempDir("", "monica")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Mkdir(filepath.Join(dir, "logs"), 0755)
+	os.Setenv("MONICA_RUNDIR", dir)
+	app := NewMonicaApp()
+	app.name = "app"
+	return app, dir
+}
+
+func TestStartCommand(t *testing.T) {
+	app, dir := newTestApp(t)
+	defer os.RemoveAll(dir)
+	defer os.Unsetenv("MONICA_RUNDIR")
+	configFile := filepath.Join(dir, "config.yaml")
+	ioutil.WriteFile(configFile, []byte("server:\n  serverport: 8205\n"), 0644)
+	oldConfiger := config.GlobalConfiger
+	defer func() {
+		if reloadable, ok := config.GlobalConfiger.(*config.ReloadableConfig); ok {
+			reloadable.StopWatch()
+		}
+		config.GlobalConfiger = oldConfiger
+	}()
+	defer StopComponents(context.Background())
+
+	// start 与不带子命令运行相同, 启动之后执行 App.Action
+	ran := false
+	app.Action = func(c *cli.Context) error {
+		ran = true
+		return nil
+	}
+	if code := runProcessCommand(t, app, "-c", configFile, "start"); code != 0 || !ran {
+		t.Errorf("start exit %d, action ran %v", code, ran)
+	}
+}
+
+// 等待SIGTERM的子进程, 用于测试 stop
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("MONICA_TEST_HELPER") == "" {
+		return
+	}
+	time.Sleep(time.Minute)
+	os.Exit(0)
+}
+
+func TestProcessCommands(t *testing.T) {
+	app, dir := newTestApp(t)
+	defer os.RemoveAll(dir)
+	defer os.Unsetenv("MONICA_RUNDIR")
+	pidFile := filepath.Join(dir, "logs", "app.pid")
+
+	// 没有运行
+	var out bytes.Buffer
+	if code := app.printStatus(&out, false); code != StatusStopped || out.String() != "stopped\n" {
+		t.Errorf("status exit %d %q", code, out.String())
+	}
+	for command, expected := range map[string]int{"status": StatusStopped, "stop": 0, "restart": 1, "reload": 1} {
+		if code := runProcessCommand(t, app, command); code != expected {
+			t.Errorf("%s exit %d, expected %d", command, code, expected)
+		}
+	}
+
+	// pid文件存在但是进程已经退出
+	dead := exec.Command("true")
+	if err := dead.Run(); err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(pidFile, []byte(fmt.Sprint(dead.Process.Pid)), 0644)
+	if code := runProcessCommand(t, app, "status"); code != StatusDead {
+		t.Errorf("status exit %d for a dead process", code)
+	}
+
+	// 正在运行的进程被 stop 停止
+	helper := exec.Command(os.Args[0], "-test.run=TestHelperProcess")
+	helper.Env = append(os.Environ(), "MONICA_TEST_HELPER=1")
+	if err := helper.Start(); err != nil {
+		t.Fatal(err)
+	}
+	go helper.Wait()
+	ioutil.WriteFile(pidFile, []byte(fmt.Sprint(helper.Process.Pid)), 0644)
+	out.Reset()
+	if code := app.printStatus(&out, false); code != StatusRunning ||
+		!strings.HasPrefix(out.String(), fmt.Sprintf("running pid=%d ", helper.Process.Pid)) {
+		t.Errorf("status exit %d %q for a running process", code, out.String())
+	}
+	if code := runProcessCommand(t, app, "stop", "--timeout", "5s"); code != 0 {
+		t.Errorf("stop exit %d", code)
+	}
+	if code := runProcessCommand(t, app, "status"); code == StatusRunning {
+		t.Error("process is still running after stop")
+	}
+}
@@ -0,0 +1,102 @@
+package monica
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/DrWrong/monica/config"
+)
+
+var (
+	// 保证同一时间只有一个reload在进行
+	reloadLock         sync.Mutex
+	reloadHandlersLock sync.Mutex
+	reloadHandlers     []func()
+)
+
+// 注册配置重新加载后的回调, 按注册的顺序调用
+// 只有新的配置通过检查并生效之后才会调用
+func RegisterReloadHandler(handlers ...func()) {
+	reloadHandlersLock.Lock()
+	defer reloadHandlersLock.Unlock()
+	reloadHandlers = append(reloadHandlers, handlers...)
+}
+
+// 重新读取配置文件, 重建log的handler与logger, 并调用 RegisterReloadHandler 注册的回调
+// 新的配置没有通过检查或者logger创建失败时保留原有的配置与logger并返回错误
+// 全局配置的 config.Reload 与配置文件变化时都会调用
+func Reload() error {
+	if err := reloadConfig(); err != nil {
+		return err
+	}
+	// 回调在锁外调用, 回调中可以注册新的回调或者再次重新加载
+	reloadHandlersLock.Lock()
+	handlers := make([]func(), len(reloadHandlers))
+	copy(handlers, reloadHandlers)
+	reloadHandlersLock.Unlock()
+	for _, handler := range handlers {
+		handler()
+	}
+	return nil
+}
+
+func reloadConfig() error {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+	reloadable, ok := config.GlobalConfiger.(*config.ReloadableConfig)
+	if !ok {
+		return fmt.Errorf("config is not loaded from file, nothing to reload")
+	}
+	configer, err := reloadable.Load()
+	if err != nil {
+		return err
+	}
+	if err := validateConfig(configer); err != nil {
+		return err
+	}
+	// 在新的配置生效之前创建logger, 失败时新的配置不会生效
+	prepared, err := prepareLogger(configer)
+	if err != nil && !config.IsNotFound(err) {
+		return err
+	}
+	// logger先生效, OnChange 的回调中使用的是新的logger
+	if prepared != nil {
+		prepared.Install()
+	}
+	reloadable.Apply(configer)
+	return nil
+}
+
+// 重新加载时对新配置的检查, 与 `config check` 相同但允许未知的key
+func validateConfig(configer config.Configer) error {
+	errs := checkConfig(configer, false)
+	if len(errs) == 0 {
+		return nil
+	}
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Errorf("invalid config: %s", strings.Join(messages, "; "))
+}
+
+// 收到 SIGHUP 后重新加载配置
+func (app *MonicaApp) handleSigHup() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	for range c {
+		log.Println("INFO: SIGHUP received, reload config")
+		if err := Reload(); err != nil {
+			log.Println("WARNING: reload config error, keep the old one", err)
+			bootStrapLogger.Warnf("reload config error, keep the old one: %s", err)
+			continue
+		}
+		log.Println("INFO: config reloaded")
+		bootStrapLogger.Info("config reloaded")
+	}
+}
@@ -0,0 +1,176 @@
+package monica
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DrWrong/monica/config"
+	"github.com/DrWrong/monica/logger"
+)
+
+func TestReloadLoggerError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monica")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "config.yaml")
+	ioutil.WriteFile(configFile, []byte("server:\n  serverport: 8205\n"), 0644)
+	oldConfiger := config.GlobalConfiger
+	defer func() {
+		config.GlobalConfiger.(*config.ReloadableConfig).StopWatch()
+		config.GlobalConfiger = oldConfiger
+	}()
+	if err := config.InitGlobalConfiger(configFile); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := 0
+	reloadHandlers = []func(){func() { reloaded++ }}
+	defer func() { reloadHandlers = nil }()
+
+	// log文件不能打开时新的配置不会生效
+	ioutil.WriteFile(configFile, []byte(`server:
+  serverport: 9000
+log:
+  handlers:
+    - name: file
+      type: FileHandler
+      args:
+        baseFileName: "`+filepath.Join(dir, "missing", "app.log")+`"
+        formatter: "{{.Message}}\n"
+`), 0644)
+	if err := Reload(); err == nil {
+		t.Error("reload with a broken log handler should fail")
+	}
+	if port, _ := config.Int("server::serverport"); port != 8205 || reloaded != 0 {
+		t.Errorf("server::serverport got %d, reload handler called %d times", port, reloaded)
+	}
+
+	ioutil.WriteFile(configFile, []byte("server:\n  serverport: 9000\n"), 0644)
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if port, _ := config.Int("server::serverport"); port != 9000 || reloaded != 1 {
+		t.Errorf("server::serverport got %d, reload handler called %d times", port, reloaded)
+	}
+}
+
+// 重新加载log配置时, 正在写log的goroutine使用新的或者旧的handler, 不会出现竞争
+// 旧的handler关闭之后不会再重新打开文件
+func TestReloadLoggerConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monica")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logConfig := func(name string) string {
+		return `log:
+  handlers:
+    - name: file
+      type: FileHandler
+      args:
+        baseFileName: "` + filepath.Join(dir, name) + `"
+        formatter: "{{.Message}}\n"
+  loggers:
+    - name: /
+      handlers: [file]
+      level: debug
+`
+	}
+	configFile := filepath.Join(dir, "config.yaml")
+	ioutil.WriteFile(configFile, []byte(logConfig("a.log")), 0644)
+	oldConfiger := config.GlobalConfiger
+	defer func() {
+		config.GlobalConfiger.(*config.ReloadableConfig).StopWatch()
+		config.GlobalConfiger = oldConfiger
+	}()
+	if err := config.InitGlobalConfiger(configFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadLogger(); err != nil {
+		t.Fatal(err)
+	}
+
+	appLogger := logger.GetLogger("/monica/test")
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					appLogger.Info("hello")
+				}
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		ioutil.WriteFile(configFile, []byte(logConfig(fmt.Sprintf("%d.log", i%2))), 0644)
+		if err := Reload(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	os.Remove(filepath.Join(dir, "0.log"))
+	appLogger.Info("after reload")
+	content, _ := ioutil.ReadFile(filepath.Join(dir, "1.log"))
+	if !strings.HasSuffix(string(content), "after reload\n") {
+		t.Errorf("the last record should be written to the current log file")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "0.log")); !os.IsNotExist(err) {
+		t.Errorf("the closed handler should not reopen the file")
+	}
+}
+
+// config.Reload 也通过 Reload 进行, 回调中可以注册新的回调
+func TestReloadHandlerRegister(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monica")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "config.yaml")
+	ioutil.WriteFile(configFile, []byte("server:\n  serverport: 8205\n"), 0644)
+	oldConfiger := config.GlobalConfiger
+	defer func() {
+		config.GlobalConfiger.(*config.ReloadableConfig).StopWatch()
+		config.GlobalConfiger = oldConfiger
+	}()
+	if err := config.InitGlobalConfiger(configFile); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := 0
+	reloadHandlers = []func(){func() {
+		reloaded++
+		RegisterReloadHandler(func() {})
+	}}
+	defer func() { reloadHandlers = nil }()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- config.Reload()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("RegisterReloadHandler in a reload handler deadlocked")
+	}
+	if reloaded != 1 || len(reloadHandlers) != 2 {
+		t.Errorf("reload handler called %d times, %d handlers", reloaded, len(reloadHandlers))
+	}
+}
@@ -0,0 +1,316 @@
+package monica
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"path"
+	"sync"
+	"time"
+
+	"git.apache.org/thrift.git/lib/go/thrift"
+	"github.com/DrWrong/monica/config"
+	"github.com/DrWrong/monica/thriftext"
+	"github.com/DrWrong/monica/webserver"
+)
+
+// 由 Run 运行的服务, 如webserver, thrift server与后台任务
+// Start 中完成监听等准备工作, 不能阻塞; Serve 阻塞直到服务出错或者被 Stop
+type Server interface {
+	Component
+	// 运行服务, Stop 之后返回的错误会被忽略
+	Serve() error
+}
+
+// 运行服务, panic也作为服务的错误
+func serve(server Server) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return server.Serve()
+}
+
+// 在同一个进程中同时运行多个服务, 如
+//
+//	monica.Run(monica.NewWebServer(initRouter), monica.NewThriftServer(processor, 9090))
+//
+// 服务作为组件与mysql, redis等一起启动, 任何一个服务启动失败时都不会开始服务并返回错误
+// 某个服务出错时停止所有的组件并返回第一个错误
+// 收到退出信号时由 App 停止所有的服务并退出进程, Run 不会返回
+// 所有服务都正常结束(如后台任务完成)时停止所有的组件并返回nil
+func Run(servers ...Server) error {
+	return lifecycle.run(servers...)
+}
+
+// 用l管理服务的启动与停止, 见 Run
+func (l *Lifecycle) run(servers ...Server) error {
+	// App 启动时已经启动了其他的组件, 服务全部注册之后再一起启动
+	// 启动失败时本次已经启动的服务会被停止
+	components := make([]Component, 0, len(servers))
+	for _, server := range servers {
+		components = append(components, server)
+	}
+	if err := l.add(components, serverDependencies...); err != nil {
+		return err
+	}
+	if err := l.Start(context.Background()); err != nil {
+		return err
+	}
+	Ready()
+
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server Server) {
+			err := serve(server)
+			// 停止过程中退出的服务由停止它的一方负责退出
+			if l.Stopping() {
+				return
+			}
+			if err != nil {
+				err = fmt.Errorf("server %s error: %s", server.Name(), err)
+			}
+			errs <- err
+		}(server)
+	}
+
+	var err error
+	for range servers {
+		if err = <-errs; err != nil {
+			log.Println("ERROR:", err, "stop all the components")
+			bootStrapLogger.Errorf("%s, stop all the components", err)
+			break
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), App.shutdownTimeout())
+	defer cancel()
+	if stopErr := l.Stop(ctx); stopErr != nil {
+		log.Println("WARNING:", stopErr)
+	}
+	return err
+}
+
+// 从配置文件的 `server` 部分读取配置并创建全局的 WebServer, 然后调用 postInitFunc 注册路由等
+func NewWebServer(postInitFunc func()) Server {
+	webServerConfig := &webserver.ServerConfig{}
+	if err := config.Unmarshal("server", webServerConfig); err != nil {
+		panic(err)
+	}
+	// 后台运行时工作目录可能已经改变, 相对路径的证书与unix socket相对于运行目录
+	for _, file := range []*string{&webServerConfig.CertFile, &webServerConfig.KeyFile} {
+		if *file != "" && !path.IsAbs(*file) {
+			*file = path.Join(runDir(), *file)
+		}
+	}
+	for _, listen := range append([]*string{&webServerConfig.Listen}, listenAddrs(webServerConfig.Listeners)...) {
+		if network, addr := webserver.ParseAddr(*listen); network == "unix" && !path.IsAbs(addr) {
+			*listen = "unix:" + path.Join(runDir(), addr)
+		}
+	}
+	WebServer = webserver.New(webServerConfig)
+	postInitFunc()
+
+	// 退出时先停止接受新的连接并等待正在处理的请求结束
+	server := WebServer
+	drainTimeout := webServerConfig.DrainTimeout
+	registerBeforeQuitWait(drainTimeout+time.Second, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Println("WARNING: webserver is not drained in", drainTimeout, "close all the connections", err)
+			bootStrapLogger.Warnf("webserver is not drained in %s, close all the connections: %s", drainTimeout, err)
+		}
+	})
+	// 有https的监听时 SIGHUP 时重新加载证书
+	if webServerConfig.HasMode("https") {
+		RegisterReloadHandler(func() {
+			if err := server.ReloadCertificate(); err != nil {
+				log.Println("WARNING:", err, "keep the old certificate")
+				bootStrapLogger.Warnf("%s, keep the old certificate", err)
+			}
+		})
+	}
+	return &webServerRunner{server: WebServer}
+}
+
+// 所有监听的地址
+func listenAddrs(listeners []*webserver.ListenerConfig) []*string {
+	addrs := make([]*string, len(listeners))
+	for i, listener := range listeners {
+		addrs[i] = &listener.Listen
+	}
+	return addrs
+}
+
+type webServerRunner struct {
+	server *webserver.WebServer
+	// 与 ListenerConfigs 一一对应的监听
+	configs   []*webserver.ListenerConfig
+	listeners []net.Listener
+}
+
+func (r *webServerRunner) Name() string {
+	return webServerComponent
+}
+
+// 在启动时加载证书并打开所有的监听, 证书错误或者任意一个端口被占用时启动失败
+func (r *webServerRunner) Start(ctx context.Context) error {
+	if r.server.Config.HasMode("https") {
+		if err := r.server.ReloadCertificate(); err != nil {
+			return err
+		}
+	}
+	r.configs = r.server.Config.ListenerConfigs()
+	r.listeners = make([]net.Listener, 0, len(r.configs))
+	for _, listenerConfig := range r.configs {
+		listener, err := r.listen(listenerConfig.Listen)
+		if err != nil {
+			for _, listener := range r.listeners {
+				listener.Close()
+			}
+			r.listeners = nil
+			return err
+		}
+		r.listeners = append(r.listeners, listener)
+	}
+	return nil
+}
+
+func (r *webServerRunner) listen(listen string) (net.Listener, error) {
+	network, addr := webserver.ParseAddr(listen)
+	listener, err := Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if network == "unix" {
+		if err := r.chownSocket(addr); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+	return listener, nil
+}
+
+func (r *webServerRunner) chownSocket(path string) error {
+	mode, err := r.server.Config.SocketFileMode()
+	if err != nil {
+		return err
+	}
+	if err := chownSocket(path, mode, r.server.Config.SocketOwner); err != nil {
+		return fmt.Errorf("set socket %s permission error: %s", path, err)
+	}
+	return nil
+}
+
+// 同时运行所有的监听, 返回先退出的一个的错误
+func (r *webServerRunner) Serve() error {
+	errs := make(chan error, len(r.listeners))
+	for i, listener := range r.listeners {
+		go func(config *webserver.ListenerConfig, listener net.Listener) {
+			errs <- r.server.ServeListener(config, listener)
+		}(r.configs[i], listener)
+	}
+	return <-errs
+}
+
+// 正常情况下 RegisterBeforeQuitWait 中已经等待请求结束, 这里关闭剩下的连接
+func (r *webServerRunner) Stop(ctx context.Context) error {
+	return r.server.Close()
+}
+
+// 在port上运行的thrift server
+func NewThriftServer(processor thrift.TProcessor, port int) Server {
+	return &thriftServerRunner{processor: processor, addr: fmt.Sprintf(":%d", port)}
+}
+
+type thriftServerRunner struct {
+	processor thrift.TProcessor
+	addr      string
+	server    *thrift.TSimpleServer
+}
+
+func (r *thriftServerRunner) Name() string {
+	return thriftServerComponent
+}
+
+func (r *thriftServerRunner) Start(ctx context.Context) error {
+	listener, err := Listen("tcp", r.addr)
+	if err != nil {
+		return err
+	}
+	transportFactory := thrift.NewTFramedTransportFactory(thrift.NewTTransportFactory())
+	protocolFactory := thrift.NewTBinaryProtocolFactoryDefault()
+	serverTransport := thriftext.NewListenerTransport(listener, 0)
+	r.server = thrift.NewTSimpleServer4(r.processor, serverTransport, transportFactory, protocolFactory)
+	log.Println("INFO: thrift server in", r.addr)
+	return nil
+}
+
+func (r *thriftServerRunner) Serve() error {
+	return r.server.Serve()
+}
+
+func (r *thriftServerRunner) Stop(ctx context.Context) error {
+	return r.server.Stop()
+}
+
+// 后台任务, run 需要在ctx结束后尽快返回, 返回错误时 Run 会停止所有的服务
+// 返回nil表示任务已经完成, 不影响其他的服务
+func NewWorker(name string, run func(ctx context.Context) error) Server {
+	return &worker{name: workerComponent + name, run: run}
+}
+
+type worker struct {
+	name    string
+	run     func(ctx context.Context) error
+	lock    sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	serving bool
+	done    chan struct{}
+}
+
+func (w *worker) Name() string {
+	return w.name
+}
+
+// 重新启动时还没有开始运行
+func (w *worker) Start(ctx context.Context) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	w.done = make(chan struct{})
+	w.serving = false
+	return nil
+}
+
+func (w *worker) Serve() error {
+	w.lock.Lock()
+	if w.ctx.Err() != nil {
+		w.lock.Unlock()
+		return nil
+	}
+	w.serving = true
+	w.lock.Unlock()
+	defer close(w.done)
+	return w.run(w.ctx)
+}
+
+// 取消任务并等待 run 返回
+func (w *worker) Stop(ctx context.Context) error {
+	w.lock.Lock()
+	w.cancel()
+	serving := w.serving
+	w.lock.Unlock()
+	if !serving {
+		return nil
+	}
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
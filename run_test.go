@@ -0,0 +1,85 @@
+package monica
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DrWrong/monica/logger"
+)
+
+func TestRun(t *testing.T) {
+	logger.InitLogger(nil, nil)
+	stopped := make(chan struct{})
+	failing := NewWorker("failing", func(ctx context.Context) error {
+		time.Sleep(10 * time.Millisecond)
+		return errors.New("boom")
+	})
+	blocking := NewWorker("blocking", func(ctx context.Context) error {
+		<-ctx.Done()
+		close(stopped)
+		return nil
+	})
+	done := NewWorker("done", func(ctx context.Context) error {
+		return nil
+	})
+
+	err := NewLifecycle().run(failing, blocking, done)
+	if err == nil || err.Error() != "server worker:failing error: boom" {
+		t.Errorf("got %v", err)
+	}
+	// 其他的服务也被停止
+	select {
+	case <-stopped:
+	default:
+		t.Error("blocking worker is not stopped")
+	}
+}
+
+// Start 失败或者记录启动与停止的服务
+type testServer struct {
+	name     string
+	startErr error
+	started  bool
+	stopped  bool
+}
+
+func (s *testServer) Name() string {
+	return s.name
+}
+
+func (s *testServer) Start(ctx context.Context) error {
+	s.started = s.startErr == nil
+	return s.startErr
+}
+
+func (s *testServer) Stop(ctx context.Context) error {
+	s.stopped = true
+	return nil
+}
+
+func (s *testServer) Serve() error {
+	return nil
+}
+
+func TestRunStartError(t *testing.T) {
+	logger.InitLogger(nil, nil)
+	l := NewLifecycle()
+	// App 启动时已经启动了组件
+	if err := l.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Stop(context.Background())
+
+	listening := &testServer{name: "listening"}
+	failing := &testServer{name: "failing", startErr: errors.New("address already in use")}
+	err := l.run(listening, failing)
+	if err == nil || err.Error() != "start component failing error: address already in use" {
+		t.Errorf("got %v", err)
+	}
+	// 启动失败时已经启动的服务被停止
+	if !listening.started || !listening.stopped {
+		t.Errorf("listening server started %v stopped %v", listening.started, listening.stopped)
+	}
+}
@@ -0,0 +1,155 @@
+package monica
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/DrWrong/monica/config"
+)
+
+// 由master启动的worker进程的标志
+const MONICA_SUPERVISED_WORKER = "MONICA_SUPERVISED_WORKER"
+
+// supervise 模式的配置 对应配置文件中的 `supervise` 部分
+type SuperviseConfig struct {
+	// 在 CrashWindow 内崩溃超过 MaxCrashes 次后master放弃并以1退出
+	MaxCrashes  int           `config:"max_crashes" default:"5"`
+	CrashWindow time.Duration `config:"crash_window" default:"1m"`
+	// 重启的退避时间 窗口内第n次崩溃后等待 Backoff * 2^(n-1) 最长不超过 MaxBackoff
+	Backoff    time.Duration `config:"backoff" default:"1s"`
+	MaxBackoff time.Duration `config:"max_backoff" default:"32s"`
+}
+
+// 第n次崩溃后的等待时间
+func (superviseConfig *SuperviseConfig) backoff(n int) time.Duration {
+	backoff := superviseConfig.Backoff
+	for i := 1; i < n && backoff < superviseConfig.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > superviseConfig.MaxBackoff {
+		backoff = superviseConfig.MaxBackoff
+	}
+	return backoff
+}
+
+func (app *MonicaApp) superviseConfig() (*SuperviseConfig, error) {
+	configer := config.GlobalConfiger
+	if !app.globalConfigInited {
+		configer = config.NewMapConfig(nil)
+	}
+	superviseConfig := &SuperviseConfig{}
+	if err := config.UnmarshalConfiger(configer, "supervise", superviseConfig); err != nil {
+		return nil, err
+	}
+	return superviseConfig, nil
+}
+
+func isSupervisedWorker() bool {
+	return os.Getenv(MONICA_SUPERVISED_WORKER) != ""
+}
+
+// 作为master运行: 用相同的参数启动worker, worker崩溃时按退避时间重启
+// SIGINT/SIGTERM/SIGHUP 会转发给worker, SIGUSR2 停止当前的worker并在它退出后启动新的worker
+// master没有监听, 不能把监听交给新的worker, 所以这里的重启不是无缝的,
+// 旧的worker退出之后到新的worker开始监听之前的连接会被拒绝
+// worker正常退出或者master收到退出信号且worker已经退出时master退出, 不会返回
+func (app *MonicaApp) runAsMaster() {
+	superviseConfig, err := app.superviseConfig()
+	if err != nil {
+		log.Println("FATAL:", err)
+		app.exit(1)
+	}
+	signals := make(chan os.Signal, 4)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR2)
+
+	var crashes []time.Time
+	for {
+		worker, err := app.startChild(
+			[]*os.File{os.Stdin, os.Stdout, os.Stderr}, "",
+			[]string{MONICA_SUPERVISED_WORKER + "=true"},
+			workerSysProcAttr(),
+		)
+		if err != nil {
+			log.Println("FATAL: start worker error", err)
+			app.exit(1)
+		}
+		log.Println("INFO: worker started at", worker.Pid)
+		exited := make(chan *os.ProcessState, 1)
+		go func() {
+			state, _ := worker.Wait()
+			exited <- state
+		}()
+
+		stopping, restarting := false, false
+		var state *os.ProcessState
+		for state == nil {
+			select {
+			case sig := <-signals:
+				switch sig {
+				case syscall.SIGUSR2:
+					log.Println("INFO: restart worker", worker.Pid, "connections are refused until the new worker is listening")
+					restarting = true
+					worker.Signal(syscall.SIGTERM)
+				case syscall.SIGHUP:
+					worker.Signal(sig)
+				default:
+					log.Println("INFO: signal received", sig, "stop worker", worker.Pid)
+					stopping = true
+					worker.Signal(sig)
+				}
+			case state = <-exited:
+			}
+		}
+
+		switch {
+		case stopping:
+			log.Println("INFO: worker exited", state, "byebye")
+			app.exit(0)
+		case restarting:
+			continue
+		case state.Success():
+			log.Println("INFO: worker exited normally")
+			app.exit(0)
+		}
+
+		now := time.Now()
+		recent := crashes[:0]
+		for _, crash := range crashes {
+			if now.Sub(crash) < superviseConfig.CrashWindow {
+				recent = append(recent, crash)
+			}
+		}
+		crashes = append(recent, now)
+		if len(crashes) > superviseConfig.MaxCrashes {
+			log.Println("FATAL: worker crashed", len(crashes), "times in", superviseConfig.CrashWindow, "give up")
+			app.exit(1)
+		}
+		backoff := superviseConfig.backoff(len(crashes))
+		log.Println("ERROR: worker", worker.Pid, "crashed", state, "restart it in", backoff)
+		app.waitBackoff(backoff, signals)
+	}
+}
+
+// 等待退避时间, 期间收到退出信号时master直接退出, 收到SIGUSR2时立即重启
+func (app *MonicaApp) waitBackoff(backoff time.Duration, signals chan os.Signal) {
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			return
+		case sig := <-signals:
+			switch sig {
+			case syscall.SIGUSR2:
+				return
+			case syscall.SIGHUP:
+			default:
+				log.Println("INFO: signal received", sig, "byebye")
+				app.exit(0)
+			}
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package monica
+
+import (
+	"syscall"
+)
+
+// worker的进程属性, master被杀掉时worker会收到SIGTERM
+func workerSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true, Pdeathsig: syscall.SIGTERM}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package monica
+
+import (
+	"syscall"
+)
+
+// worker的进程属性, 只有linux支持 Pdeathsig, master被杀掉时worker不会收到信号
+func workerSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
@@ -0,0 +1,16 @@
+package monica
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSuperviseBackoff(t *testing.T) {
+	superviseConfig := &SuperviseConfig{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, backoff := range expected {
+		if got := superviseConfig.backoff(i + 1); got != backoff {
+			t.Errorf("backoff(%d) got %s, expected %s", i+1, got, backoff)
+		}
+	}
+}
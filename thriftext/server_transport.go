@@ -0,0 +1,48 @@
+package thriftext
+
+import (
+	"net"
+	"time"
+
+	"git.apache.org/thrift.git/lib/go/thrift"
+)
+
+// 基于已有的 net.Listener 的 thrift.TServerTransport
+// 用于重启时直接使用从父进程继承的监听
+type ListenerTransport struct {
+	listener      net.Listener
+	clientTimeout time.Duration
+}
+
+func NewListenerTransport(listener net.Listener, clientTimeout time.Duration) *ListenerTransport {
+	return &ListenerTransport{
+		listener:      listener,
+		clientTimeout: clientTimeout,
+	}
+}
+
+// listener已经在监听, 什么都不做
+func (t *ListenerTransport) Listen() error {
+	return nil
+}
+
+func (t *ListenerTransport) Accept() (thrift.TTransport, error) {
+	conn, err := t.listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return thrift.NewTSocketFromConnTimeout(conn, t.clientTimeout), nil
+}
+
+func (t *ListenerTransport) Close() error {
+	return t.listener.Close()
+}
+
+// 关闭listener使阻塞的Accept返回
+func (t *ListenerTransport) Interrupt() error {
+	return t.listener.Close()
+}
+
+func (t *ListenerTransport) Addr() net.Addr {
+	return t.listener.Addr()
+}
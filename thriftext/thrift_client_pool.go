@@ -69,12 +69,7 @@ func (w *WrappedClient) CallWithRetry(name string, args ...interface{}) (res int
 			w.p.closeAllClient()
 		}
 
-		t := i
-		if t >= 5 {
-			t = 5
-		}
-
-		time.Sleep((1 << t) * time.Second)
+		time.Sleep(w.p.retryBackoff(i))
 		w, _ = w.p.Get()
 
 	}
@@ -148,6 +143,10 @@ type Pool struct {
 	// 是否使用通用header
 	// WithCommonHeader bool
 	MaxRetry uint
+	// 重试的退避时间, 第n次重试等待 RetryBackoff * 2^n, 为0时默认为1秒
+	RetryBackoff time.Duration
+	// 最长的退避时间, 为0时默认为32秒
+	MaxRetryBackoff time.Duration
 	// mu protects fields defined below
 	mu   sync.Mutex
 	cond *sync.Cond
@@ -157,6 +156,25 @@ type Pool struct {
 	idle list.List
 }
 
+// 第n次重试前需要等待的时间
+func (p *Pool) retryBackoff(n uint) time.Duration {
+	backoff := p.RetryBackoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	maxBackoff := p.MaxRetryBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 32 * time.Second
+	}
+	for ; n > 0 && backoff < maxBackoff; n-- {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
 // release decrements the active count and signals waiters. The caller must
 // hold p.mu during the call.
 // 释放一个现有链接
@@ -181,12 +199,15 @@ func (p *Pool) newThriftClient() (thriftClient ThriftClient, err error) {
 	protocolFactory := thrift.NewTBinaryProtocolFactoryDefault()
 
 	// 随机选取第一个可用的host，如果所有host都不可用那么抛出异常
-	hostLen := len(p.Host)
+	p.mu.Lock()
+	hosts := p.Host
+	p.mu.Unlock()
+	hostLen := len(hosts)
 	randHostSlect := rand.Perm(hostLen)
 	// host := p.Host[hostLen/randNum]
 	var transport thrift.TTransport
 	for _, idx := range randHostSlect {
-		host := p.Host[idx]
+		host := hosts[idx]
 		transport, err = thrift.NewTSocket(host)
 		if err != nil {
 			continue
@@ -231,6 +252,24 @@ func (p *Pool) closeAllClient() {
 
 }
 
+// 关掉所有空闲的链接，在程序退出时调用
+func (p *Pool) Close() {
+	p.closeAllClient()
+}
+
+// 更新连接池的主机列表与大小，已有的空闲链接会被关掉
+func (p *Pool) Update(hosts []string, maxIdle, maxActive int) {
+	p.mu.Lock()
+	p.Host = hosts
+	p.MaxIdle = maxIdle
+	p.MaxActive = maxActive
+	if p.cond != nil {
+		p.cond.Broadcast()
+	}
+	p.mu.Unlock()
+	p.closeAllClient()
+}
+
 // 获取一个client
 func (p *Pool) Get() (*WrappedClient, error) {
 	p.mu.Lock()
@@ -0,0 +1,210 @@
+package webserver
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// fastcgi的记录类型
+const (
+	fcgiBeginRequest = 1
+	fcgiEndRequest   = 3
+	fcgiParams       = 4
+	fcgiStdin        = 5
+)
+
+// fastcgi的记录头的长度
+const fcgiHeaderLen = 8
+
+// fastcgi连接上正在读取的内容
+const (
+	// 等待下一个请求
+	fcgiWaiting = iota
+	// 读取请求的参数, 即http的请求头
+	fcgiReadingParams
+	// 读取请求体
+	fcgiReadingStdin
+)
+
+var errFastCGIParamsTooLarge = errors.New("fastcgi params too large")
+
+// 记录 fastcgi 的连接, 退出时关闭
+type fcgiListener struct {
+	net.Listener
+	server *WebServer
+}
+
+func (l *fcgiListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	s := l.server
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.shuttingDown {
+		conn.Close()
+		return nil, errors.New("fastcgi server is shutting down")
+	}
+	c := &fcgiConn{Conn: conn, server: s}
+	s.fcgiConns[c] = struct{}{}
+	return c, nil
+}
+
+// fastcgi的连接, 解析读写的记录以跟踪请求的状态, 实现与 http.Server 相同的超时与请求头的限制
+// net/http/fcgi 每次写入一个完整的记录, 读取时则可能分多次
+type fcgiConn struct {
+	net.Conn
+	server *WebServer
+
+	lock sync.Mutex
+	// 正在读取的记录头, 以及当前记录还没有读取的字节数
+	header  [fcgiHeaderLen]byte
+	headerN int
+	remain  int
+	state   int
+	// 已经开始还没有结束的请求数
+	active int
+	// 最近一个请求开始的时间
+	start       time.Time
+	paramsBytes int
+	// 解析出错后之后的读取都返回该错误, 读取满时 io.ReadFull 会忽略同时返回的错误
+	err error
+}
+
+func (c *fcgiConn) Read(p []byte) (int, error) {
+	c.lock.Lock()
+	if c.err != nil {
+		c.lock.Unlock()
+		return 0, c.err
+	}
+	deadline := c.readDeadline()
+	c.lock.Unlock()
+	c.Conn.SetReadDeadline(deadline)
+
+	n, err := c.Conn.Read(p)
+	c.lock.Lock()
+	c.err = c.parse(p[:n])
+	if err == nil {
+		err = c.err
+	}
+	c.lock.Unlock()
+	return n, err
+}
+
+func (c *fcgiConn) Write(p []byte) (int, error) {
+	c.lock.Lock()
+	var deadline time.Time
+	if timeout := c.server.Config.WriteTimeout; timeout > 0 && c.active > 0 {
+		deadline = c.start.Add(timeout)
+	}
+	c.lock.Unlock()
+	c.Conn.SetWriteDeadline(deadline)
+
+	n, err := c.Conn.Write(p)
+	if len(p) >= 2 && p[1] == fcgiEndRequest {
+		c.lock.Lock()
+		// 请求被中止时会写入两次结束的记录
+		if c.active > 0 {
+			c.active--
+		}
+		c.lock.Unlock()
+	}
+	return n, err
+}
+
+func (c *fcgiConn) Close() error {
+	c.server.lock.Lock()
+	delete(c.server.fcgiConns, c)
+	c.server.lock.Unlock()
+	return c.Conn.Close()
+}
+
+// 下一次读取的截止时间, 零值表示不限制
+func (c *fcgiConn) readDeadline() time.Time {
+	config := c.server.Config
+	timeout := config.ReadTimeout
+	switch c.state {
+	case fcgiReadingParams:
+		if config.ReadHeaderTimeout > 0 {
+			timeout = config.ReadHeaderTimeout
+		}
+	case fcgiReadingStdin:
+	default:
+		// 请求正在处理, 连接上不会有新的请求
+		if c.active > 0 {
+			return time.Time{}
+		}
+		if config.IdleTimeout > 0 {
+			timeout = config.IdleTimeout
+		}
+		if timeout > 0 {
+			return time.Now().Add(timeout)
+		}
+	}
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return c.start.Add(timeout)
+}
+
+// 解析读取到的内容, 在每个记录头读取完整时更新请求的状态
+func (c *fcgiConn) parse(b []byte) error {
+	for len(b) > 0 {
+		if c.remain > 0 {
+			n := len(b)
+			if n > c.remain {
+				n = c.remain
+			}
+			c.remain -= n
+			b = b[n:]
+			continue
+		}
+		n := copy(c.header[c.headerN:], b)
+		c.headerN += n
+		b = b[n:]
+		if c.headerN < fcgiHeaderLen {
+			break
+		}
+		c.headerN = 0
+		contentLen := int(binary.BigEndian.Uint16(c.header[4:6]))
+		c.remain = contentLen + int(c.header[6])
+		if err := c.onRecord(c.header[1], contentLen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *fcgiConn) onRecord(recType byte, contentLen int) error {
+	switch recType {
+	case fcgiBeginRequest:
+		c.active++
+		c.start = time.Now()
+		c.state = fcgiReadingParams
+		c.paramsBytes = 0
+	case fcgiParams:
+		// 空的记录表示参数结束
+		if contentLen == 0 {
+			c.state = fcgiReadingStdin
+			break
+		}
+		c.paramsBytes += contentLen
+		max := int(c.server.Config.MaxHeaderBytes)
+		if max <= 0 {
+			max = http.DefaultMaxHeaderBytes
+		}
+		if c.paramsBytes > max {
+			return errFastCGIParamsTooLarge
+		}
+	case fcgiStdin:
+		if contentLen == 0 {
+			c.state = fcgiWaiting
+		}
+	}
+	return nil
+}
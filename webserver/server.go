@@ -1,59 +1,399 @@
 package webserver
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
 	"net/http/fcgi"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/DrWrong/monica/config"
 	"github.com/DrWrong/monica/middleware"
 	"gopkg.in/macaron.v1"
 )
 
+// webserver的配置 对应配置文件中的 `server` 部分
 type ServerConfig struct {
-	Port       int    // 端口号
-	ServerMode string // 运行模式
-	URLPrefix  string // URL 前缀
+	Port       int    `config:"serverport"`                // 端口号
+	ServerMode string `config:"servermode" default:"http"` // 运行模式
+	URLPrefix  string `config:"urlPrefix"`                 // URL 前缀
+	// 监听的地址, 如 `127.0.0.1:8080` 或者unix socket `unix:/run/app.sock`, 为空时监听 serverport
+	Listen string `config:"listen"`
+	// unix socket文件的权限, 八进制, yaml中需要加引号
+	SocketMode string `config:"socket_mode" default:"'0660'"`
+	// unix socket文件的所有者, 形如 `user` 或者 `user:group`, 为空时不修改
+	SocketOwner string `config:"socket_owner"`
+	// 退出时等待正在处理的请求结束的时间, 超时后关闭所有的连接
+	DrainTimeout time.Duration `config:"drain_timeout" default:"10s"`
+
+	// 以下的超时与限制对 http 与 fastcgi 模式都有效, 为0时不限制, 含义与 http.Server 相同
+	// 读取整个请求的超时时间
+	ReadTimeout time.Duration `config:"read_timeout"`
+	// 读取请求头的超时时间, 为0时使用 ReadTimeout
+	ReadHeaderTimeout time.Duration `config:"read_header_timeout" default:"10s"`
+	// 写入响应的超时时间
+	WriteTimeout time.Duration `config:"write_timeout"`
+	// keep-alive的连接等待下一个请求的超时时间, 为0时使用 ReadTimeout
+	IdleTimeout time.Duration `config:"idle_timeout" default:"2m"`
+	// 请求头的最大字节数, 为0时使用 http.DefaultMaxHeaderBytes
+	MaxHeaderBytes config.ByteSize `config:"max_header_bytes"`
+	// 请求体的最大字节数, 超过时返回413
+	MaxBodyBytes config.ByteSize `config:"max_body_bytes"`
+
+	// https 模式的证书与私钥文件, 收到 SIGHUP 或者文件修改后重新加载
+	CertFile string `config:"cert_file"`
+	KeyFile  string `config:"key_file"`
+	// 检查证书文件是否修改的间隔, 为0时只在 SIGHUP 时重新加载
+	CertCheckInterval time.Duration `config:"cert_check_interval" default:"10s"`
+	// 最低的TLS版本, 1.0, 1.1, 1.2 或者 1.3
+	TLSMinVersion string `config:"tls_min_version" default:"'1.2'"`
+	// 把http请求重定向到https的端口, 为0时不启动
+	RedirectPort int `config:"redirect_port"`
+
+	// 同时运行的多个监听, 配置后忽略上面的 servermode, listen, serverport, urlPrefix 与 redirect_port
+	// 其他的配置(超时, 证书等)由所有的监听共享
+	Listeners []*ListenerConfig `config:"listeners"`
+}
+
+// `server::listeners` 中的一个监听
+type ListenerConfig struct {
+	// http, https, fastcgi 或者 redirect (把http请求重定向到https)
+	ServerMode string `config:"servermode" default:"http"`
+	// 监听的地址, 格式与 `server::listen` 相同
+	Listen string `config:"listen,required"`
+	// URL 前缀, 只对这个监听的请求有效
+	URLPrefix string `config:"urlPrefix"`
 }
 
 type WebServer struct {
 	*macaron.Macaron
 	Config *ServerConfig
+	// http 模式下运行的server
+	HTTPServer *http.Server
+	// https 模式下运行的server, 同一个 http.Server 运行过 Serve 后 ServeTLS 不会启用http2
+	tlsServer *http.Server
+	// 把http请求重定向到https的server
+	redirectServer *http.Server
+	cert           certificate
+	watchOnce      sync.Once
+	// Shutdown 或者 Close 时关闭
+	done     chan struct{}
+	doneOnce sync.Once
+
+	lock         sync.Mutex
+	shuttingDown bool
+	// fastcgi 模式下的监听与连接
+	fcgiListeners map[net.Listener]struct{}
+	fcgiConns     map[net.Conn]struct{}
+	// fastcgi 模式下正在处理的请求数
+	fcgiActive int64
 }
 
 func New(config *ServerConfig) *WebServer {
-	return &WebServer{
-		Macaron: macaron.New(),
-		Config:  config,
+	s := &WebServer{
+		Macaron:       macaron.New(),
+		Config:        config,
+		fcgiListeners: make(map[net.Listener]struct{}),
+		fcgiConns:     make(map[net.Conn]struct{}),
+		done:          make(chan struct{}),
+	}
+	s.HTTPServer = s.newHTTPServer(s.Handler())
+	s.tlsServer = s.newHTTPServer(s.Handler())
+	s.redirectServer = s.newHTTPServer(http.HandlerFunc(s.redirect))
+	minVersion, _ := ParseTLSVersion(config.TLSMinVersion)
+	s.tlsServer.TLSConfig = &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: s.cert.get,
+	}
+	return s
+}
+
+func (s *WebServer) newHTTPServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadTimeout:       s.Config.ReadTimeout,
+		ReadHeaderTimeout: s.Config.ReadHeaderTimeout,
+		WriteTimeout:      s.Config.WriteTimeout,
+		IdleTimeout:       s.Config.IdleTimeout,
+		MaxHeaderBytes:    int(s.Config.MaxHeaderBytes),
+		ConnContext:       urlPrefixContext,
+	}
+}
+
+// 处理请求的 http.Handler, 与 macaron 相比多了 max_body_bytes 的限制
+func (s *WebServer) Handler() http.Handler {
+	return http.HandlerFunc(s.serveRequest)
+}
+
+// 去掉监听的URL前缀并限制请求体的大小后交给macaron处理
+func (s *WebServer) serveRequest(w http.ResponseWriter, r *http.Request) {
+	if prefix, ok := r.Context().Value(urlPrefixKey{}).(string); ok {
+		r.URL.Path = strings.TrimPrefix(r.URL.Path, prefix)
+	}
+	if max := int64(s.Config.MaxBodyBytes); max > 0 {
+		if r.ContentLength > max {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, max)
 	}
+	s.ServeHTTP(w, r)
+}
+
+// unix socket文件的权限
+func (config *ServerConfig) SocketFileMode() (os.FileMode, error) {
+	mode, err := strconv.ParseUint(config.SocketMode, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid socket mode %q", config.SocketMode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// 解析监听的地址, `unix:` 开头的为unix socket, 其他的为tcp
+func ParseAddr(addr string) (network, address string) {
+	if strings.HasPrefix(addr, "unix:") {
+		return "unix", strings.TrimPrefix(addr, "unix:")
+	}
+	return "tcp", addr
+}
+
+// `listen` 或者 `serverport` 对应的监听地址
+func (config *ServerConfig) Addr() string {
+	if config.Listen != "" {
+		return config.Listen
+	}
+	return fmt.Sprintf(":%d", config.Port)
+}
+
+// 所有的监听, 没有配置 `listeners` 时为 `servermode` 对应的监听
+// 以及 https 模式下配置了 `redirect_port` 时的重定向的监听
+func (config *ServerConfig) ListenerConfigs() []*ListenerConfig {
+	if len(config.Listeners) > 0 {
+		return config.Listeners
+	}
+	listeners := []*ListenerConfig{{
+		ServerMode: config.ServerMode,
+		Listen:     config.Addr(),
+		URLPrefix:  config.URLPrefix,
+	}}
+	if config.ServerMode == "https" && config.RedirectPort > 0 {
+		listeners = append(listeners, &ListenerConfig{
+			ServerMode: "redirect",
+			Listen:     fmt.Sprintf(":%d", config.RedirectPort),
+		})
+	}
+	return listeners
+}
+
+// 是否有mode模式的监听
+func (config *ServerConfig) HasMode(mode string) bool {
+	for _, listener := range config.ListenerConfigs() {
+		if listener.ServerMode == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// 监听的地址, 与 `listen` 的格式相同, 配置了多个监听时为第一个
+func (s *WebServer) Addr() string {
+	return s.Config.ListenerConfigs()[0].Listen
+}
+
+// 监听的网络与地址, 如 ("unix", "/run/app.sock")
+func (s *WebServer) ListenAddr() (network, address string) {
+	return ParseAddr(s.Addr())
 }
 
 func (s *WebServer) Run() {
-	s.SetURLPrefix(s.Config.URLPrefix)
-	addr := fmt.Sprintf(":%d", s.Config.Port)
-	switch s.Config.ServerMode {
+	listener, err := net.Listen(s.ListenAddr())
+	if err != nil {
+		panic(err)
+	}
+	if err := s.Serve(listener); err != nil {
+		panic(err)
+	}
+}
+
+// 在已有的listener上以 `servermode` 运行server, listener关闭后返回
+// Shutdown 或者 Close 之后返回 http.ErrServerClosed
+func (s *WebServer) Serve(listener net.Listener) error {
+	return s.ServeListener(&ListenerConfig{ServerMode: s.Config.ServerMode, URLPrefix: s.Config.URLPrefix}, listener)
+}
+
+// 在已有的listener上按config运行server, 同一个 WebServer 可以同时运行多个监听
+// 所有的监听共享 Shutdown 与 Close
+func (s *WebServer) ServeListener(config *ListenerConfig, listener net.Listener) error {
+	if config.URLPrefix != "" {
+		listener = &prefixListener{Listener: listener, prefix: config.URLPrefix}
+	}
+	switch config.ServerMode {
 	case "http":
-		fmt.Printf("run http server on %s\n", addr)
-		err := http.ListenAndServe(addr, s)
-		if err != nil {
-			panic(err)
-		}
+		fmt.Printf("run http server on %s\n", listener.Addr())
+		return s.HTTPServer.Serve(listener)
+	case "https":
+		fmt.Printf("run https server on %s\n", listener.Addr())
+		return s.serveTLS(listener)
 	case "fastcgi":
-		fmt.Printf("run fastcgi server on %s\n", addr)
+		fmt.Printf("run fastcgi server on %s\n", listener.Addr())
+		return s.serveFastCGI(listener)
+	case "redirect":
+		return s.ServeRedirect(listener)
+	default:
+		return fmt.Errorf("not implement server mode %s", config.ServerMode)
+	}
+}
+
+// 请求的context中监听的URL前缀的key
+type urlPrefixKey struct{}
+
+// 记录URL前缀的监听, 接受的连接上的请求会去掉该前缀
+type prefixListener struct {
+	net.Listener
+	prefix string
+}
+
+func (l *prefixListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &prefixConn{Conn: conn, prefix: l.prefix}, nil
+}
+
+type prefixConn struct {
+	net.Conn
+	prefix string
+}
 
-		listener, err := net.Listen("tcp", addr)
-		if err != nil {
-			panic(err)
+// 把连接的URL前缀加入context, 用于 http.Server.ConnContext
+func urlPrefixContext(ctx context.Context, conn net.Conn) context.Context {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	if prefixConn, ok := conn.(*prefixConn); ok {
+		return context.WithValue(ctx, urlPrefixKey{}, prefixConn.prefix)
+	}
+	return ctx
+}
+
+func (s *WebServer) serveFastCGI(listener net.Listener) error {
+	s.lock.Lock()
+	if s.shuttingDown {
+		s.lock.Unlock()
+		return http.ErrServerClosed
+	}
+	s.fcgiListeners[listener] = struct{}{}
+	s.lock.Unlock()
+
+	err := fcgi.Serve(&fcgiListener{Listener: listener, server: s}, s.fastCGIHandler(listener))
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.fcgiListeners, listener)
+	if s.shuttingDown {
+		return http.ErrServerClosed
+	}
+	return err
+}
+
+func (s *WebServer) serveFastCGIRequest(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&s.fcgiActive, 1)
+	defer atomic.AddInt64(&s.fcgiActive, -1)
+	s.serveRequest(w, r)
+}
+
+// fastcgi的连接上的请求没有经过 ConnContext, 在这里加入URL前缀
+func (s *WebServer) fastCGIHandler(listener net.Listener) http.Handler {
+	prefixListener, ok := listener.(*prefixListener)
+	if !ok {
+		return http.HandlerFunc(s.serveFastCGIRequest)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), urlPrefixKey{}, prefixListener.prefix)
+		s.serveFastCGIRequest(w, r.WithContext(ctx))
+	})
+}
+
+// 停止接受新的连接, 等待正在处理的请求结束后关闭所有的连接
+// ctx结束时还没有处理完的连接会被直接关闭, 并返回ctx的错误
+func (s *WebServer) Shutdown(ctx context.Context) error {
+	s.closeDone()
+	s.closeFastCGIListeners()
+	// 同时关闭所有server的监听
+	servers := []*http.Server{s.HTTPServer, s.tlsServer, s.redirectServer}
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *http.Server) { errs <- server.Shutdown(ctx) }(server)
+	}
+	var httpErr error
+	for range servers {
+		if err := <-errs; err != nil {
+			httpErr = err
 		}
-		err = fcgi.Serve(listener, s)
-		if err != nil {
-			panic(err)
+	}
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for atomic.LoadInt64(&s.fcgiActive) > 0 {
+		select {
+		case <-ctx.Done():
+			s.Close()
+			return ctx.Err()
+		case <-ticker.C:
 		}
-	default:
-		panic("not implement server mode")
+	}
+	s.closeFastCGIConns()
+	if httpErr != nil {
+		s.Close()
+	}
+	return httpErr
+}
+
+// 立即关闭所有的监听与连接
+func (s *WebServer) Close() error {
+	s.closeDone()
+	s.closeFastCGIListeners()
+	s.closeFastCGIConns()
+	s.redirectServer.Close()
+	s.tlsServer.Close()
+	return s.HTTPServer.Close()
+}
+
+func (s *WebServer) closeDone() {
+	s.doneOnce.Do(func() { close(s.done) })
+}
 
+// 关闭 fastcgi 的监听, 之后不再接受新的连接
+func (s *WebServer) closeFastCGIListeners() {
+	s.lock.Lock()
+	s.shuttingDown = true
+	listeners := make([]net.Listener, 0, len(s.fcgiListeners))
+	for listener := range s.fcgiListeners {
+		listeners = append(listeners, listener)
+	}
+	s.lock.Unlock()
+	for _, listener := range listeners {
+		listener.Close()
 	}
+}
 
+func (s *WebServer) closeFastCGIConns() {
+	s.lock.Lock()
+	conns := make([]net.Conn, 0, len(s.fcgiConns))
+	for conn := range s.fcgiConns {
+		conns = append(conns, conn)
+	}
+	s.lock.Unlock()
+	for _, conn := range conns {
+		conn.Close()
+	}
 }
 
 type SessionContext struct {
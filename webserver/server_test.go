@@ -0,0 +1,276 @@
+package webserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 处理请求时会等待release的server
+func newSlowServer(t *testing.T, mode string) (*WebServer, net.Listener, chan struct{}, chan struct{}) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	s := New(&ServerConfig{ServerMode: mode})
+	s.Get("/slow", func() string {
+		started <- struct{}{}
+		<-release
+		return "done"
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, listener, started, release
+}
+
+func TestShutdownHTTP(t *testing.T) {
+	s, listener, started, release := newSlowServer(t, "http")
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(listener) }()
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String() + "/slow")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		content, _ := ioutil.ReadAll(resp.Body)
+		body <- string(content)
+	}()
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(context.Background()) }()
+	// 正在处理请求时不再接受新的连接
+	time.Sleep(50 * time.Millisecond)
+	if conn, err := net.Dial("tcp", listener.Addr().String()); err == nil {
+		conn.Close()
+		t.Error("listener should be closed")
+	}
+	close(release)
+	if got := <-body; got != "done" {
+		t.Errorf("in-flight request got %q", got)
+	}
+	if err := <-shutdown; err != nil {
+		t.Error(err)
+	}
+	if err := <-served; err != http.ErrServerClosed {
+		t.Errorf("serve got %v", err)
+	}
+}
+
+func TestShutdownFastCGI(t *testing.T) {
+	s, listener, started, release := newSlowServer(t, "fastcgi")
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(listener) }()
+
+	body := make(chan string, 1)
+	go func() {
+		content, err := fcgiGet(listener.Addr().String(), "/slow")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		body <- content
+	}()
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(context.Background()) }()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	if got := <-body; !strings.HasSuffix(got, "done") {
+		t.Errorf("in-flight request got %q", got)
+	}
+	if err := <-shutdown; err != nil {
+		t.Error(err)
+	}
+	if err := <-served; err != http.ErrServerClosed {
+		t.Errorf("serve got %v", err)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	s, listener, started, release := newSlowServer(t, "fastcgi")
+	defer close(release)
+	go s.Serve(listener)
+	go fcgiGet(listener.Addr().String(), "/slow")
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("got %v", err)
+	}
+}
+
+// 用一个连接发送一个fastcgi的GET请求, 返回stdout的内容
+func fcgiGet(addr, uri string) (string, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	record := func(recType uint8, content []byte) []byte {
+		header := []byte{1, recType, 0, 1, 0, 0, 0, 0}
+		binary.BigEndian.PutUint16(header[4:], uint16(len(content)))
+		return append(header, content...)
+	}
+	var params []byte
+	for _, kv := range [][2]string{{"REQUEST_METHOD", "GET"}, {"REQUEST_URI", uri}, {"SERVER_PROTOCOL", "HTTP/1.1"}} {
+		params = append(params, byte(len(kv[0])), byte(len(kv[1])))
+		params = append(params, kv[0]+kv[1]...)
+	}
+	var request []byte
+	// FCGI_BEGIN_REQUEST, role为responder
+	request = append(request, record(1, []byte{0, 1, 0, 0, 0, 0, 0, 0})...)
+	// FCGI_PARAMS
+	request = append(request, record(4, params)...)
+	request = append(request, record(4, nil)...)
+	// FCGI_STDIN
+	request = append(request, record(5, nil)...)
+	if _, err := conn.Write(request); err != nil {
+		return "", err
+	}
+
+	var stdout bytes.Buffer
+	for {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return "", err
+		}
+		content := make([]byte, int(binary.BigEndian.Uint16(header[4:]))+int(header[6]))
+		if _, err := io.ReadFull(conn, content); err != nil {
+			return "", err
+		}
+		switch header[1] {
+		// FCGI_STDOUT
+		case 6:
+			stdout.Write(content[:len(content)-int(header[6])])
+		// FCGI_END_REQUEST
+		case 3:
+			return stdout.String(), nil
+		}
+	}
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	s := New(&ServerConfig{ServerMode: "http", MaxBodyBytes: 4})
+	s.Post("/echo", func(r *http.Request) (int, string) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return http.StatusRequestEntityTooLarge, err.Error()
+		}
+		return http.StatusOK, string(body)
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(listener)
+	defer s.Close()
+
+	url := "http://" + listener.Addr().String() + "/echo"
+	for body, status := range map[string]int{"1234": http.StatusOK, "12345": http.StatusRequestEntityTooLarge} {
+		resp, err := http.Post(url, "text/plain", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("body %q got status %d", body, resp.StatusCode)
+		}
+	}
+}
+
+func TestFastCGILimits(t *testing.T) {
+	s := New(&ServerConfig{ServerMode: "fastcgi", ReadHeaderTimeout: 50 * time.Millisecond, MaxHeaderBytes: 64})
+	s.Get("/", func() string { return "ok" })
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(listener)
+	defer s.Close()
+
+	if body, err := fcgiGet(listener.Addr().String(), "/"); err != nil || !strings.HasSuffix(body, "ok") {
+		t.Errorf("got %q %v", body, err)
+	}
+	// 参数超过 max_header_bytes 时关闭连接
+	if _, err := fcgiGet(listener.Addr().String(), "/"+strings.Repeat("a", 64)); err == nil {
+		t.Error("params larger than max_header_bytes should be rejected")
+	}
+
+	// 参数没有在 read_header_timeout 内发送完时关闭连接
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte{1, fcgiBeginRequest, 0, 1, 0, 8, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("connection should be closed after read_header_timeout, got %v", err)
+	}
+}
+
+func TestServeListeners(t *testing.T) {
+	s := New(&ServerConfig{})
+	s.Get("/user", func() string { return "user" })
+	configs := []*ListenerConfig{
+		{ServerMode: "http", URLPrefix: "/api"},
+		{ServerMode: "fastcgi", URLPrefix: "/fcgi"},
+	}
+	listeners := make([]net.Listener, len(configs))
+	served := make(chan error, len(configs))
+	for i, config := range configs {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listeners[i] = listener
+		go func(config *ListenerConfig) { served <- s.ServeListener(config, listener) }(config)
+	}
+
+	// 每个监听只去掉自己的前缀
+	resp, err := http.Get("http://" + listeners[0].Addr().String() + "/api/user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "user" {
+		t.Errorf("http got %q", body)
+	}
+	resp, err = http.Get("http://" + listeners[0].Addr().String() + "/fcgi/user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("http with the fastcgi prefix got status %d", resp.StatusCode)
+	}
+	if content, err := fcgiGet(listeners[1].Addr().String(), "/fcgi/user"); err != nil || !strings.HasSuffix(content, "user") {
+		t.Errorf("fastcgi got %q %v", content, err)
+	}
+
+	// 一次 Shutdown 停止所有的监听
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+	for range configs {
+		if err := <-served; err != http.ErrServerClosed {
+			t.Errorf("serve got %v", err)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package webserver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// 解析 `tls_min_version`, 如 "1.2"
+func ParseTLSVersion(version string) (uint16, error) {
+	v, ok := tlsVersions[version]
+	if !ok {
+		return 0, fmt.Errorf("not support tls version %q, accept 1.0, 1.1, 1.2, 1.3", version)
+	}
+	return v, nil
+}
+
+// https 模式下使用的证书, 可以在不关闭监听的情况下替换
+type certificate struct {
+	lock sync.RWMutex
+	cert *tls.Certificate
+	// 证书与私钥文件在加载时的修改时间
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+func (c *certificate) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.cert == nil {
+		return nil, fmt.Errorf("certificate is not loaded")
+	}
+	return c.cert, nil
+}
+
+// 文件是否在加载之后被修改过
+func (c *certificate) changed(certFile, keyFile string) bool {
+	certStat, err := os.Stat(certFile)
+	if err != nil {
+		return false
+	}
+	keyStat, err := os.Stat(keyFile)
+	if err != nil {
+		return false
+	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return !certStat.ModTime().Equal(c.certModTime) || !keyStat.ModTime().Equal(c.keyModTime)
+}
+
+func (c *certificate) load(certFile, keyFile string) error {
+	// 先记录修改时间, 加载过程中文件被修改时下一次检查会重新加载
+	certStat, err := os.Stat(certFile)
+	if err != nil {
+		return err
+	}
+	keyStat, err := os.Stat(keyFile)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.cert = &cert
+	c.certModTime = certStat.ModTime()
+	c.keyModTime = keyStat.ModTime()
+	return nil
+}
+
+// 重新加载 `cert_file` 与 `key_file`, 失败时继续使用原来的证书
+// 已经建立的连接不受影响, 之后的握手使用新的证书
+func (s *WebServer) ReloadCertificate() error {
+	if err := s.cert.load(s.Config.CertFile, s.Config.KeyFile); err != nil {
+		return fmt.Errorf("load certificate %s error: %s", s.Config.CertFile, err)
+	}
+	return nil
+}
+
+// 定期检查证书文件, 修改后重新加载, 直到 Shutdown 或者 Close
+func (s *WebServer) watchCertificate() {
+	if s.Config.CertCheckInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.Config.CertCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+		if !s.cert.changed(s.Config.CertFile, s.Config.KeyFile) {
+			continue
+		}
+		if err := s.ReloadCertificate(); err != nil {
+			log.Println("WARNING: certificate changed but reload failed, keep the old one", err)
+			continue
+		}
+		log.Println("INFO: certificate reloaded", s.Config.CertFile)
+	}
+}
+
+func (s *WebServer) serveTLS(listener net.Listener) error {
+	if _, err := ParseTLSVersion(s.Config.TLSMinVersion); err != nil {
+		return err
+	}
+	if _, err := s.cert.get(nil); err != nil {
+		if err := s.ReloadCertificate(); err != nil {
+			return err
+		}
+	}
+	s.watchOnce.Do(func() { go s.watchCertificate() })
+	return s.tlsServer.ServeTLS(listener, "", "")
+}
+
+// 在listener上运行把http请求重定向到https的server
+func (s *WebServer) ServeRedirect(listener net.Listener) error {
+	fmt.Printf("run https redirect server on %s\n", listener.Addr())
+	return s.redirectServer.Serve(listener)
+}
+
+// 重定向到https的地址, 端口为第一个https监听的端口, 监听unix socket时使用默认的端口
+func (s *WebServer) redirect(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	port := ""
+	for _, listener := range s.Config.ListenerConfigs() {
+		if listener.ServerMode != "https" {
+			continue
+		}
+		if network, addr := ParseAddr(listener.Listen); network == "tcp" {
+			_, port, _ = net.SplitHostPort(addr)
+		}
+		break
+	}
+	if port != "" && port != "0" && port != "443" {
+		host = net.JoinHostPort(host, port)
+	}
+	status := http.StatusMovedPermanently
+	// 保留请求的方法与请求体
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		status = http.StatusPermanentRedirect
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+}
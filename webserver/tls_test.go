@@ -0,0 +1,180 @@
+package webserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 生成序列号为serial的自签名证书
+func writeCertificate(t *testing.T, certFile, keyFile string, serial int64) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	// 保证修改时间变化
+	modTime := time.Now().Add(time.Duration(serial) * time.Second)
+	os.Chtimes(certFile, modTime, modTime)
+	os.Chtimes(keyFile, modTime, modTime)
+}
+
+// 握手时服务端证书的序列号
+func certificateSerial(t *testing.T, addr string, config *tls.Config) int64 {
+	conn, err := tls.Dial("tcp", addr, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+}
+
+func TestHTTPS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCertificate(t, certFile, keyFile, 1)
+
+	s := New(&ServerConfig{
+		ServerMode:        "https",
+		CertFile:          certFile,
+		KeyFile:           keyFile,
+		CertCheckInterval: 20 * time.Millisecond,
+		TLSMinVersion:     "1.2",
+	})
+	s.Get("/", func() string { return "ok" })
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(listener)
+	defer s.Close()
+
+	addr := listener.Addr().String()
+	config := &tls.Config{InsecureSkipVerify: true}
+	if serial := certificateSerial(t, addr, config); serial != 1 {
+		t.Errorf("got serial %d", serial)
+	}
+
+	// 文件修改后同一个监听使用新的证书
+	writeCertificate(t, certFile, keyFile, 2)
+	time.Sleep(100 * time.Millisecond)
+	if serial := certificateSerial(t, addr, config); serial != 2 {
+		t.Errorf("got serial %d after the certificate changed", serial)
+	}
+
+	// 低于 tls_min_version 的连接被拒绝
+	if conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS11}); err == nil {
+		conn.Close()
+		t.Error("tls 1.1 should be rejected")
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	s := New(&ServerConfig{Port: 8443, ServerMode: "https", RedirectPort: 8080})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.ServeRedirect(listener)
+	defer s.Close()
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get("http://" + listener.Addr().String() + "/api/user?id=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMovedPermanently {
+		t.Errorf("got status %d", resp.StatusCode)
+	}
+	if location := resp.Header.Get("Location"); location != "https://127.0.0.1:8443/api/user?id=1" {
+		t.Errorf("got location %s", location)
+	}
+}
+
+func TestListenerConfigs(t *testing.T) {
+	config := &ServerConfig{Port: 8443, ServerMode: "https", URLPrefix: "/api", RedirectPort: 8080}
+	listeners := config.ListenerConfigs()
+	if len(listeners) != 2 || *listeners[0] != (ListenerConfig{"https", ":8443", "/api"}) ||
+		*listeners[1] != (ListenerConfig{ServerMode: "redirect", Listen: ":8080"}) {
+		t.Errorf("got %v %v", listeners[0], listeners[1:])
+	}
+	// 配置了 listeners 时忽略上面的配置
+	config.Listeners = []*ListenerConfig{{ServerMode: "http", Listen: "unix:/tmp/app.sock"}}
+	if listeners := config.ListenerConfigs(); len(listeners) != 1 || config.HasMode("https") {
+		t.Errorf("got %v", listeners)
+	}
+}
+
+func TestHTTPSWithHTTP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCertificate(t, certFile, keyFile, 1)
+
+	s := New(&ServerConfig{CertFile: certFile, KeyFile: keyFile, TLSMinVersion: "1.2"})
+	s.Get("/user", func(r *http.Request) string { return r.Proto })
+	listeners := make([]net.Listener, 2)
+	for i, mode := range []string{"http", "https"} {
+		if listeners[i], err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+			t.Fatal(err)
+		}
+		go s.ServeListener(&ListenerConfig{ServerMode: mode, URLPrefix: "/" + mode}, listeners[i])
+		time.Sleep(20 * time.Millisecond)
+	}
+	defer s.Close()
+
+	// 同时运行http的监听时https的监听仍然支持http2
+	client := &http.Client{Transport: &http.Transport{
+		ForceAttemptHTTP2: true,
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+	}}
+	resp, err := client.Get("https://" + listeners[1].Addr().String() + "/https/user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "HTTP/2.0" {
+		t.Errorf("got %q", body)
+	}
+}